@@ -0,0 +1,61 @@
+package common
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrDuplicateMessage is returned when a consumer already processed the message
+	ErrDuplicateMessage = errors.New("message was already processed")
+	// ErrMissingMessageID is returned for deliveries published without an AMQP message id
+	ErrMissingMessageID = errors.New("message has no message id")
+)
+
+// ProcessedMessage is the inbox ledger, one row per message a consumer handled
+type ProcessedMessage struct {
+	Consumer    string    `gorm:"primaryKey;type:varchar(100)"`
+	MessageID   string    `gorm:"primaryKey;type:varchar(255)"`
+	ProcessedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// MigrateInbox creates the processed message table in the service database
+func MigrateInbox(db *gorm.DB) error {
+	return db.AutoMigrate(&ProcessedMessage{})
+}
+
+// MarkProcessed records the message for the consumer, it has to run in the same transaction as the
+// side effect of the message so both are committed or rolled back together. A message that was
+// already recorded returns ErrDuplicateMessage and the caller should roll back and ack it
+func MarkProcessed(tx *gorm.DB, consumer, messageID string) error {
+	if messageID == "" {
+		return ErrMissingMessageID
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ProcessedMessage{
+		Consumer:  consumer,
+		MessageID: messageID,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDuplicateMessage
+	}
+	return nil
+}
+
+// IsProcessed is a cheap check before doing any work, MarkProcessed remains the source of truth
+func IsProcessed(db *gorm.DB, consumer, messageID string) (bool, error) {
+	var count int64
+	err := db.Model(&ProcessedMessage{}).
+		Where("consumer = ? AND message_id = ?", consumer, messageID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
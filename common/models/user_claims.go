@@ -5,6 +5,7 @@ import (
 )
 
 type Claims struct {
-	Role string `json:"role"`
+	Role   string `json:"role"`
+	UserID string `json:"user_id"`
 	jwt.StandardClaims
 }
@@ -0,0 +1,276 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// DefaultCurrency is assumed for amounts that come without a currency code, e.g. legacy decimal prices
+const DefaultCurrency = "USD"
+
+// minorUnits is the number of decimal places every supported currency uses
+const minorUnits = 2
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidAmount    = errors.New("invalid money amount")
+	ErrInvalidCurrency  = errors.New("invalid currency code")
+)
+
+// Money is an exact amount in minor units (cents) of a currency. Amounts are kept as integers so
+// sums of prices do not collect floating point rounding errors.
+// Models store it with `gorm:"embedded;embeddedPrefix:<column>_"` as <column>_minor and <column>_currency
+type Money struct {
+	Amount   int64  `gorm:"column:minor;type:bigint"` // Minor units, 1234 is 12.34
+	Currency string `gorm:"type:char(3)"`             // ISO 4217 code
+}
+
+// NewMoney returns an amount given in minor units
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney reads a decimal string like "12.34" in the given currency, at most two decimals are allowed.
+// Negative amounts are refused, prices and amounts sent in by clients are never below zero
+func ParseMoney(value string, currency string) (Money, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if !validCurrency(currency) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+	}
+
+	value = strings.TrimSpace(value)
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || len(fraction) > minorUnits || !digits(whole) || !digits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	fraction += strings.Repeat("0", minorUnits-len(fraction))
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}, nil
+}
+
+// Zero returns a zero amount in the currency
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// Decimal formats the amount without currency, e.g. "12.34"
+func (m Money) Decimal() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// String formats the amount with its currency, e.g. "12.34 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.currency()
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Equal compares amount and currency
+func (m Money) Equal(other Money) bool {
+	return m.Amount == other.Amount && m.currency() == other.currency()
+}
+
+// Add returns m + other, both have to be in the same currency. A zero value without currency takes the other currency
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := m.sameCurrency(other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: currency}, nil
+}
+
+// Sub returns m - other, both have to be in the same currency
+func (m Money) Sub(other Money) (Money, error) {
+	currency, err := m.sameCurrency(other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: currency}, nil
+}
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// Convert returns the amount in another currency given how many units of currency one unit of m buys.
+// The result is rounded half away from zero to the minor unit
+func (m Money) Convert(currency string, rate float64) Money {
+	if m.currency() == currency {
+		return m
+	}
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rate)), Currency: currency}
+}
+
+// Cmp returns -1, 0 or 1 when m is less than, equal to or greater than other
+func (m Money) Cmp(other Money) (int, error) {
+	if _, err := m.sameCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Sum adds up amounts of the same currency
+func Sum(amounts ...Money) (Money, error) {
+	var total Money
+	for _, amount := range amounts {
+		var err error
+		total, err = total.Add(amount)
+		if err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON writes {"amount":"12.34","currency":"USD"}, the amount is a string so clients never see a float
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{
+		Amount:   m.Decimal(),
+		Currency: m.currency(),
+	})
+}
+
+// UnmarshalJSON accepts the object form written by MarshalJSON, with the amount as string or number,
+// and a bare number or string which is read in DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	currency := ""
+	amount := data
+	if bytes.HasPrefix(data, []byte("{")) {
+		var raw moneyJSON
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		currency = raw.Currency
+		amount = raw.Amount
+	}
+
+	parsed, err := ParseMoney(strings.Trim(string(amount), `"`), currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MoneyAmount lets validator/v10 check Money fields by their amount, e.g. `binding:"required,gt=0"`.
+// Register it with RegisterCustomTypeFunc(common.MoneyAmount, common.Money{})
+func MoneyAmount(field reflect.Value) interface{} {
+	if money, ok := field.Interface().(Money); ok {
+		return money.Amount
+	}
+	return nil
+}
+
+// MigrateMoneyColumns moves prices out of the decimal columns they used to be stored in, e.g. a float "price",
+// into the <column>_minor and <column>_currency columns of the embedded Money and drops the old column. The old
+// prices had no currency and are read in DefaultCurrency. It has to run after AutoMigrate created the new columns
+func MigrateMoneyColumns(db *gorm.DB, table string, columns ...string) error {
+	for _, column := range columns {
+		if !db.Migrator().HasColumn(table, column) {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Exec(fmt.Sprintf(`
+				UPDATE %[1]s SET
+					%[2]s_minor = round(%[2]s::numeric * 100)::bigint,
+					%[2]s_currency = '%[3]s'
+				WHERE %[2]s IS NOT NULL`, table, column, DefaultCurrency)).Error
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(table, column)
+		})
+		if err != nil {
+			return fmt.Errorf("error migrating money column %s.%s: %w", table, column, err)
+		}
+	}
+	return nil
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+func (m Money) sameCurrency(other Money) (string, error) {
+	switch {
+	case m.Currency == other.Currency:
+		return m.Currency, nil
+	case m.Currency == "" && m.Amount == 0:
+		return other.Currency, nil
+	case other.Currency == "" && other.Amount == 0:
+		return m.Currency, nil
+	default:
+		return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency(), other.currency())
+	}
+}
+
+func validCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+		err      error
+	}{
+		{value: "12.34", currency: "USD", want: NewMoney(1234, "USD")},
+		{value: "12", currency: "USD", want: NewMoney(1200, "USD")},
+		{value: "12.3", currency: "EUR", want: NewMoney(1230, "EUR")},
+		{value: " 0.05 ", currency: "usd", want: NewMoney(5, "USD")},
+		{value: "7.50", currency: "", want: NewMoney(750, DefaultCurrency)},
+		{value: "-1.00", currency: "USD", err: ErrInvalidAmount},
+		{value: "1.234", currency: "USD", err: ErrInvalidAmount},
+		{value: ".50", currency: "USD", err: ErrInvalidAmount},
+		{value: "", currency: "USD", err: ErrInvalidAmount},
+		{value: "1e3", currency: "USD", err: ErrInvalidAmount},
+		{value: "99999999999999999999", currency: "USD", err: ErrInvalidAmount},
+		{value: "1.00", currency: "US", err: ErrInvalidCurrency},
+		{value: "1.00", currency: "U1D", err: ErrInvalidCurrency},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.value, tt.currency)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseMoney(%q, %q) error = %v, want %v", tt.value, tt.currency, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q, %q) = %+v, want %+v", tt.value, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     Money
+		sum      Money
+		diff     Money
+		mismatch bool
+	}{
+		{name: "same currency", a: NewMoney(1000, "USD"), b: NewMoney(250, "USD"), sum: NewMoney(1250, "USD"), diff: NewMoney(750, "USD")},
+		{name: "zero without currency", a: Money{}, b: NewMoney(250, "EUR"), sum: NewMoney(250, "EUR"), diff: NewMoney(-250, "EUR")},
+		{name: "other zero without currency", a: NewMoney(250, "EUR"), b: Money{}, sum: NewMoney(250, "EUR"), diff: NewMoney(250, "EUR")},
+		{name: "different currencies", a: NewMoney(1000, "USD"), b: NewMoney(250, "EUR"), mismatch: true},
+		{name: "zero in another currency", a: Zero("USD"), b: NewMoney(250, "EUR"), mismatch: true},
+	}
+	for _, tt := range tests {
+		sum, err := tt.a.Add(tt.b)
+		if tt.mismatch {
+			if !errors.Is(err, ErrCurrencyMismatch) {
+				t.Errorf("%s: Add error = %v, want %v", tt.name, err, ErrCurrencyMismatch)
+			}
+		} else if err != nil || sum != tt.sum {
+			t.Errorf("%s: Add = %+v, %v, want %+v", tt.name, sum, err, tt.sum)
+		}
+
+		diff, err := tt.a.Sub(tt.b)
+		if tt.mismatch {
+			if !errors.Is(err, ErrCurrencyMismatch) {
+				t.Errorf("%s: Sub error = %v, want %v", tt.name, err, ErrCurrencyMismatch)
+			}
+		} else if err != nil || diff != tt.diff {
+			t.Errorf("%s: Sub = %+v, %v, want %+v", tt.name, diff, err, tt.diff)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   Money
+		currency string
+		rate     float64
+		want     Money
+	}{
+		{name: "exact", amount: NewMoney(1000, "USD"), currency: "EUR", rate: 0.9, want: NewMoney(900, "EUR")},
+		{name: "rounds half up", amount: NewMoney(1005, "USD"), currency: "EUR", rate: 0.5, want: NewMoney(503, "EUR")},
+		{name: "rounds down", amount: NewMoney(1001, "USD"), currency: "EUR", rate: 0.333, want: NewMoney(333, "EUR")},
+		{name: "rounds half away from zero", amount: NewMoney(-1005, "USD"), currency: "EUR", rate: 0.5, want: NewMoney(-503, "EUR")},
+		{name: "same currency keeps the amount", amount: NewMoney(1005, "USD"), currency: "USD", rate: 0.5, want: NewMoney(1005, "USD")},
+		{name: "no currency is the default", amount: Money{Amount: 1005}, currency: DefaultCurrency, rate: 0.5, want: Money{Amount: 1005}},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Convert(tt.currency, tt.rate); got != tt.want {
+			t.Errorf("%s: Convert = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	for _, amount := range []Money{NewMoney(1234, "USD"), NewMoney(5, "EUR"), Zero("GBP"), NewMoney(-250, "USD")} {
+		data, err := json.Marshal(amount)
+		if err != nil {
+			t.Fatalf("Marshal(%+v): %v", amount, err)
+		}
+		var got Money
+		err = json.Unmarshal(data, &got)
+		switch {
+		case amount.IsNegative():
+			// Amounts sent in are never below zero, negative ones only go out, e.g. discounts
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Unmarshal(%s) error = %v, want %v", data, err, ErrInvalidAmount)
+			}
+		case err != nil || got != amount:
+			t.Errorf("Unmarshal(%s) = %+v, %v, want %+v", data, got, err, amount)
+		}
+	}
+
+	tests := []struct {
+		data string
+		want Money
+		fail bool
+	}{
+		{data: `{"amount":"12.34","currency":"USD"}`, want: NewMoney(1234, "USD")},
+		{data: `{"amount":12.5,"currency":"eur"}`, want: NewMoney(1250, "EUR")},
+		{data: `{"amount":"3"}`, want: NewMoney(300, DefaultCurrency)},
+		{data: `19.99`, want: NewMoney(1999, DefaultCurrency)},
+		{data: `"19.99"`, want: NewMoney(1999, DefaultCurrency)},
+		{data: `null`, want: Money{}},
+		{data: `{"amount":"1.999","currency":"USD"}`, fail: true},
+		{data: `{"amount":"1.00","currency":"DOLLARS"}`, fail: true},
+	}
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.data), &got)
+		if (err != nil) != tt.fail {
+			t.Errorf("Unmarshal(%s) error = %v, want failure %v", tt.data, err, tt.fail)
+			continue
+		}
+		if !tt.fail && got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.data, got, tt.want)
+		}
+	}
+
+	data, err := json.Marshal(NewMoney(1234, "USD"))
+	if err != nil || string(data) != `{"amount":"12.34","currency":"USD"}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+}
+
+func TestMoneyAmountValidation(t *testing.T) {
+	validate := validator.New()
+	validate.RegisterCustomTypeFunc(MoneyAmount, Money{})
+
+	type price struct {
+		Price    Money  `validate:"gt=0"`
+		Discount *Money `validate:"omitempty,gt=0"`
+	}
+	positive := NewMoney(1, "USD")
+	zero := Zero("USD")
+	tests := []struct {
+		name  string
+		value price
+		valid bool
+	}{
+		{name: "positive", value: price{Price: NewMoney(1234, "USD")}, valid: true},
+		{name: "zero", value: price{Price: zero}},
+		{name: "negative", value: price{Price: NewMoney(-1, "USD")}},
+		{name: "positive pointer", value: price{Price: positive, Discount: &positive}, valid: true},
+		{name: "zero pointer", value: price{Price: positive, Discount: &zero}},
+	}
+	for _, tt := range tests {
+		err := validate.Struct(tt.value)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: Struct error = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
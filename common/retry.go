@@ -0,0 +1,122 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// AttemptsHeader counts how often a delivery was processed and failed
+	AttemptsHeader = "x-attempts"
+	// RejectionHeader carries why a delivery was dead lettered
+	RejectionHeader = "x-rejection-reason"
+)
+
+// RetryPolicy bounds how often a consumer retries a delivery it failed to process. Failed deliveries wait on a
+// delay queue that feeds them back to the work queue, once they failed MaxAttempts times they are dead lettered
+type RetryPolicy struct {
+	Queue       string // Work queue the consumer reads
+	Exchange    string // Exchange and routing key the work queue is bound with
+	RoutingKey  string
+	DeadLetter  string // Fanout exchange of the dead letter queue
+	Delay       time.Duration
+	MaxAttempts int
+}
+
+func (p RetryPolicy) delayQueue() string {
+	return p.Queue + "_retry"
+}
+
+func (p RetryPolicy) deadQueue() string {
+	return p.Queue + "_dead"
+}
+
+// DeclareRetry declares the delay queue of the policy and its dead letter exchange and queue. Messages expire
+// from the delay queue after the delay and the broker routes them back to the work queue
+func (rc RabbitClient) DeclareRetry(policy RetryPolicy) error {
+	_, err := rc.ch.QueueDeclare(policy.delayQueue(), true, false, false, false, amqp.Table{
+		"x-message-ttl":             policy.Delay.Milliseconds(),
+		"x-dead-letter-exchange":    policy.Exchange,
+		"x-dead-letter-routing-key": policy.RoutingKey,
+	})
+	if err != nil {
+		return err
+	}
+	if err := rc.ch.ExchangeDeclare(policy.DeadLetter, "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := rc.CreateQueue(policy.deadQueue(), true, false); err != nil {
+		return err
+	}
+	return rc.CreateBinding(policy.deadQueue(), "", policy.DeadLetter)
+}
+
+// Retry acks a delivery that failed and republishes it on the delay queue, or on the dead letter exchange once it
+// failed policy.MaxAttempts times. It reports whether the delivery was dead lettered. When the republish fails the
+// delivery is requeued instead, so it is not lost
+func (rc RabbitClient) Retry(ctx context.Context, policy RetryPolicy, msg amqp.Delivery, cause error) (bool, error) {
+	attempts := Attempts(msg) + 1
+	if attempts >= policy.MaxAttempts {
+		reason := fmt.Sprintf("gave up after %d attempts: %v", attempts, cause)
+		return true, rc.DeadLetter(ctx, policy.DeadLetter, msg, reason)
+	}
+
+	headers := copyHeaders(msg.Headers)
+	headers[AttemptsHeader] = int32(attempts)
+	headers["x-last-error"] = cause.Error()
+	if err := rc.Send(ctx, "", policy.delayQueue(), republish(msg, headers)); err != nil {
+		msg.Nack(false, true)
+		return false, err
+	}
+	return false, msg.Ack(false)
+}
+
+// DeadLetter acks the delivery and republishes it on the dead letter exchange along with the reason. When the
+// republish fails the delivery is rejected without requeue
+func (rc RabbitClient) DeadLetter(ctx context.Context, exchange string, msg amqp.Delivery, reason string) error {
+	headers := copyHeaders(msg.Headers)
+	headers[RejectionHeader] = reason
+	if err := rc.Send(ctx, exchange, "", republish(msg, headers)); err != nil {
+		msg.Nack(false, false)
+		return err
+	}
+	return msg.Ack(false)
+}
+
+// Attempts returns how often the delivery failed before
+func Attempts(msg amqp.Delivery) int {
+	switch n := msg.Headers[AttemptsHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	default:
+		return 0
+	}
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := make(amqp.Table, len(headers)+2)
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
+
+// republish keeps what consumers read off a delivery, the app id names the publisher and the message id
+// is the deduplication key
+func republish(msg amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.MessageId,
+		AppId:        msg.AppId,
+		Body:         msg.Body,
+		Headers:      headers,
+	}
+}
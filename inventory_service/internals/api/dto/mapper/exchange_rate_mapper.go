@@ -0,0 +1,19 @@
+package mapper
+
+import (
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/dto/response"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
+)
+
+func MapExchangeRatesToResponse(rates []models.ExchangeRate) []response.ExchangeRateResponse {
+	rateResponses := make([]response.ExchangeRateResponse, 0, len(rates))
+	for _, rate := range rates {
+		rateResponses = append(rateResponses, response.ExchangeRateResponse{
+			BaseCurrency:  rate.BaseCurrency,
+			QuoteCurrency: rate.QuoteCurrency,
+			Rate:          rate.Rate,
+			UpdatedAt:     rate.UpdatedAt,
+		})
+	}
+	return rateResponses
+}
@@ -36,17 +36,12 @@ func MapProductToResponse(product *models.Product) response.ProductResponse {
 
 // MapVariantToResponse maps a ProductVariant model to the ProductVariantResponse struct
 func MapVariantToResponse(variant *models.ProductVariant) response.ProductVariantResponse {
-	price := 0.0
-	if variant.Price != nil {
-		price = *variant.Price
-	}
-
 	return response.ProductVariantResponse{
 		ID:         variant.ID,
 		SKU:        variant.SKU,
 		Size:       variant.Size,
 		Color:      variant.Color,
-		Price:      price,
+		Price:      variant.Price,
 		StockLevel: variant.StockQuantity,
 	}
 }
@@ -90,7 +85,7 @@ func MapProductVariantToRequest(Productvariant *request.ProductVariantRequest, i
 		ID:            id,
 		Color:         Productvariant.Color,
 		Size:          Productvariant.Size,
-		Price:         Productvariant.Price,
+		Price:         *Productvariant.Price,
 		StockQuantity: Productvariant.StockLevel,
 		SKU:           Productvariant.SKU,
 	}
@@ -0,0 +1,122 @@
+package mapper
+
+import (
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/dto/request"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/dto/response"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/repository"
+)
+
+// MapStockLevelsToResponse reports every requested item against the stock levels. Each item is checked on its own,
+// an atomic check is satisfiable when the stock of every variant covers all the items asking for it
+func MapStockLevelsToResponse(req *request.CheckStockRequest, levels map[string]repository.StockLevel) response.CheckStockResponse {
+	items := make([]response.StockAvailabilityResponse, 0, len(req.Items))
+	needed := make(map[string]int, len(req.Items))
+	satisfiable := true
+
+	for _, item := range req.Items {
+		availability := response.StockAvailabilityResponse{
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+		}
+		level, ok := levels[item.VariantID]
+		switch {
+		case !ok:
+			availability.Code = response.StockNotFound
+			availability.Error = "variant not found"
+		case level.Price == nil:
+			availability.StockLevel = level.Available
+			availability.Code = response.StockCurrencyNotSupported
+			availability.Error = "currency not supported"
+		default:
+			availability.StockLevel = level.Available
+			availability.Price = level.Price
+			availability.Available = level.Available >= item.Quantity
+			availability.Code = response.StockOK
+			if !availability.Available {
+				availability.Code = response.StockInsufficient
+			}
+		}
+		if availability.Error != "" {
+			satisfiable = false
+		}
+
+		needed[item.VariantID] += item.Quantity
+		items = append(items, availability)
+	}
+
+	checkResponse := response.CheckStockResponse{Items: items}
+	if req.Atomic {
+		for variantID, quantity := range needed {
+			if levels[variantID].Available < quantity {
+				satisfiable = false
+			}
+		}
+		checkResponse.Satisfiable = &satisfiable
+	}
+	return checkResponse
+}
+
+// defaultMovementPageSize is used when a ledger listing does not ask for a page size
+const defaultMovementPageSize = 50
+
+func MapMovementQuery(req *request.ListMovementsRequest) repository.MovementQuery {
+	query := repository.MovementQuery{
+		VariantID: req.VariantID,
+		Kind:      models.MovementKind(req.Kind),
+		From:      req.From,
+		To:        req.To,
+		Page:      req.Page,
+		PageSize:  req.PageSize,
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultMovementPageSize
+	}
+	return query
+}
+
+func MapMovementToResponse(movement *models.StockMovement) response.StockMovementResponse {
+	return response.StockMovementResponse{
+		ID:            movement.ID,
+		VariantID:     movement.VariantID,
+		Kind:          string(movement.Kind),
+		Delta:         movement.Delta,
+		ReservedDelta: movement.ReservedDelta,
+		Reason:        movement.Reason,
+		ReferenceID:   movement.ReferenceID,
+		Actor:         movement.Actor,
+		CreatedAt:     movement.CreatedAt,
+	}
+}
+
+func MapMovementsToResponse(movements []models.StockMovement, query repository.MovementQuery, total int64) response.StockMovementsResponse {
+	movementResponses := make([]response.StockMovementResponse, 0, len(movements))
+	for _, movement := range movements {
+		movementResponses = append(movementResponses, MapMovementToResponse(&movement))
+	}
+
+	return response.StockMovementsResponse{
+		Movements:  movementResponses,
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+		Total:      total,
+		TotalPages: (total + int64(query.PageSize) - 1) / int64(query.PageSize),
+	}
+}
+
+func MapDiscrepanciesToResponse(discrepancies []models.StockDiscrepancy) []response.StockDiscrepancyResponse {
+	discrepancyResponses := make([]response.StockDiscrepancyResponse, 0, len(discrepancies))
+	for _, discrepancy := range discrepancies {
+		discrepancyResponses = append(discrepancyResponses, response.StockDiscrepancyResponse{
+			VariantID:      discrepancy.VariantID,
+			StockQuantity:  discrepancy.StockQuantity,
+			LedgerStock:    discrepancy.LedgerStock,
+			Reserved:       discrepancy.Reserved,
+			LedgerReserved: discrepancy.LedgerReserved,
+		})
+	}
+	return discrepancyResponses
+}
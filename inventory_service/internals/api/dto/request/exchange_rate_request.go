@@ -0,0 +1,5 @@
+package request
+
+type ExchangeRateRequest struct {
+	Rate float64 `json:"rate" binding:"required,gt=0"` // Units of the quote currency one unit of the base currency buys
+}
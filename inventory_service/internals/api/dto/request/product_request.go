@@ -1,5 +1,7 @@
 package request
 
+import "github.com/palashbhasme/ecommerce_microservices/common"
+
 type ProductRequest struct {
 	Name        string                  `json:"name" binding:"required"`
 	Description string                  `json:"description" binding:"required"`
@@ -11,13 +13,26 @@ type ProductRequest struct {
 }
 
 type ProductVariantRequest struct {
-	Color      string   `json:"color"`
-	Size       string   `json:"size"`
-	ProductID  string   `json:"product_id" binding:"required"`
-	Price      *float64 `json:"price" binding:"required"`
-	StockLevel int      `json:"stock_quantity"`
-	SKU        string   `json:"sku" binding:"required"`
+	Color      string        `json:"color"`
+	Size       string        `json:"size"`
+	ProductID  string        `json:"product_id" binding:"required"`
+	Price      *common.Money `json:"price" binding:"required,gt=0"` // A bare number is read in the default currency
+	StockLevel int           `json:"stock_quantity"`
+	SKU        string        `json:"sku" binding:"required"`
 }
 type UpdateQuantityRequest struct {
-	Quantity int `json:"quantity" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required"`
+	Currency string `json:"currency" binding:"omitempty,len=3"` // Price is converted to this currency when set
+}
+
+// CheckStockRequest asks for the availability of several variants at once
+type CheckStockRequest struct {
+	Items    []CheckStockItem `json:"items" binding:"required,min=1,max=100,dive"`
+	Currency string           `json:"currency" binding:"omitempty,len=3"` // Prices are converted to this currency when set
+	Atomic   bool             `json:"atomic"`                             // Also report whether all items are available together
+}
+
+type CheckStockItem struct {
+	VariantID string `json:"variant_id" binding:"required,uuid"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
 }
@@ -0,0 +1,19 @@
+package request
+
+import "time"
+
+// AdjustStockRequest changes the on-hand stock of a variant by hand, e.g. after a stock count or for damaged goods
+type AdjustStockRequest struct {
+	Delta  int    `json:"delta" binding:"required"` // Added to the stock, negative takes stock off
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// ListMovementsRequest filters the stock ledger, read from the query string
+type ListMovementsRequest struct {
+	VariantID string    `form:"variant_id" binding:"omitempty,uuid"`
+	Kind      string    `form:"kind" binding:"omitempty,oneof=opening adjustment order restock return reservation"`
+	From      time.Time `form:"from"` // RFC 3339, created at or after
+	To        time.Time `form:"to"`   // RFC 3339, created before
+	Page      int       `form:"page" binding:"omitempty,min=1"`
+	PageSize  int       `form:"page_size" binding:"omitempty,min=1,max=200"`
+}
@@ -0,0 +1,10 @@
+package response
+
+import "time"
+
+type ExchangeRateResponse struct {
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Rate          float64   `json:"rate"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -1,12 +1,18 @@
 package response
 
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
 type ProductVariantResponse struct {
-	ID         string  `json:"id"`
-	SKU        string  `json:"sku"`
-	Price      float64 `json:"price"`
-	StockLevel int     `json:"stock_level"`
-	Size       string  `json:"size"`
-	Color      string  `json:"color"`
+	ID         string       `json:"id"`
+	SKU        string       `json:"sku"`
+	Price      common.Money `json:"price"`
+	StockLevel int          `json:"stock_level"`
+	Size       string       `json:"size"`
+	Color      string       `json:"color"`
 }
 
 type ProductResponse struct {
@@ -20,3 +26,56 @@ type ProductResponse struct {
 	CreatedAt   string                   `json:"created_at"`
 	UpdatedAt   string                   `json:"updated_at"`
 }
+
+// Codes of a StockAvailabilityResponse, clients switch on them rather than on the error message
+const (
+	StockOK                   = "ok"
+	StockNotFound             = "not_found"
+	StockInsufficient         = "insufficient_stock"
+	StockCurrencyNotSupported = "currency_not_supported"
+)
+
+// StockAvailabilityResponse is the availability of one requested item
+type StockAvailabilityResponse struct {
+	VariantID  string        `json:"variant_id"`
+	Quantity   int           `json:"quantity"`
+	StockLevel int           `json:"stock_level"`
+	Available  bool          `json:"available"`
+	Price      *common.Money `json:"price"`
+	Code       string        `json:"code"`            // One of the Stock codes
+	Error      string        `json:"error,omitempty"` // Why the item cannot be ordered besides stock
+}
+
+type CheckStockResponse struct {
+	Items       []StockAvailabilityResponse `json:"items"`
+	Satisfiable *bool                       `json:"satisfiable,omitempty"` // Set for atomic checks
+}
+
+type StockMovementResponse struct {
+	ID            string    `json:"id"`
+	VariantID     string    `json:"variant_id"`
+	Kind          string    `json:"kind"`
+	Delta         int       `json:"delta"`          // On-hand stock
+	ReservedDelta int       `json:"reserved_delta"` // Stock held for orders
+	Reason        string    `json:"reason,omitempty"`
+	ReferenceID   string    `json:"reference_id,omitempty"`
+	Actor         string    `json:"actor"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type StockMovementsResponse struct {
+	Movements  []StockMovementResponse `json:"movements"`
+	Page       int                     `json:"page"`
+	PageSize   int                     `json:"page_size"`
+	Total      int64                   `json:"total"`
+	TotalPages int64                   `json:"total_pages"`
+}
+
+// StockDiscrepancyResponse is a variant whose stock does not add up to its ledger
+type StockDiscrepancyResponse struct {
+	VariantID      string `json:"variant_id"`
+	StockQuantity  int    `json:"stock_quantity"`
+	LedgerStock    int    `json:"ledger_stock"`
+	Reserved       int    `json:"reserved"`
+	LedgerReserved int    `json:"ledger_reserved"`
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palashbhasme/ecommerce_microservices/common/middlewares"
+	"github.com/palashbhasme/ecommerce_microservices/common/models"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/dto/request"
+	domain "github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/repository"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ExchangeRateHandler struct {
+	repo   repository.ExchangeRateRepository
+	logger *zap.Logger
+}
+
+func NewExchangeRateHandler(router *gin.Engine, repo repository.ExchangeRateRepository, logger *zap.Logger) {
+	rateHandler := &ExchangeRateHandler{
+		repo:   repo,
+		logger: logger,
+	}
+	authconfig := models.NewAuthConfig(os.Getenv("JWT_SECRET"))
+	api := router.Group("/api")
+	{
+		rateRoutes := api.Group("/rates/v1")
+		rateRoutes.Use(middlewares.AuthMiddleware(*authconfig))
+		{
+			rateRoutes.GET("/", rateHandler.GetAllExchangeRates)
+
+			protectedRoutes := rateRoutes.Group("/")
+			protectedRoutes.Use(middlewares.AdminMiddleware())
+			{
+				protectedRoutes.PUT("/:base/:quote", rateHandler.SetExchangeRate)
+				protectedRoutes.DELETE("/:base/:quote", rateHandler.DeleteExchangeRate)
+			}
+		}
+	}
+}
+
+func (h *ExchangeRateHandler) GetAllExchangeRates(c *gin.Context) {
+	rates, err := h.repo.GetAllExchangeRates()
+	if err != nil {
+		h.logger.Error("failed to get exchange rates", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to get exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rates": mapper.MapExchangeRatesToResponse(rates)})
+}
+
+// SetExchangeRate creates or replaces the rate for converting base prices to the quote currency
+func (h *ExchangeRateHandler) SetExchangeRate(c *gin.Context) {
+	var rateRequest request.ExchangeRateRequest
+	if err := c.ShouldBindJSON(&rateRequest); err != nil {
+		h.logger.Error("failed to bind request", zap.Error(err))
+		c.JSON(400, gin.H{"error": "invalid request"})
+		return
+	}
+
+	base, quote := c.Param("base"), c.Param("quote")
+	if len(base) != 3 || len(quote) != 3 {
+		c.JSON(400, gin.H{"error": "currencies must be 3 letter codes"})
+		return
+	}
+
+	rate := domain.ExchangeRate{BaseCurrency: base, QuoteCurrency: quote, Rate: rateRequest.Rate}
+	if err := h.repo.UpsertExchangeRate(&rate); err != nil {
+		h.logger.Error("failed to save exchange rate", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to save exchange rate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "exchange rate saved successfully"})
+}
+
+func (h *ExchangeRateHandler) DeleteExchangeRate(c *gin.Context) {
+	err := h.repo.DeleteExchangeRate(c.Param("base"), c.Param("quote"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "exchange rate not found"})
+			return
+		}
+		h.logger.Error("failed to delete exchange rate", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to delete exchange rate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "exchange rate deleted successfully"})
+}
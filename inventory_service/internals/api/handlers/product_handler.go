@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"os"
 
@@ -36,6 +37,7 @@ func NewProductHandler(router *gin.Engine, repo repository.ProductRepository, lo
 			productRoutes.GET("/getall", productHandler.GetAllProducts)
 			productRoutes.GET("/getbycategoryid/:categoryID", productHandler.GetProductsByCategoryID)
 			productRoutes.GET("/getbycategoryname/:categoryName", productHandler.GetProductsByCategoryName)
+			productRoutes.POST("/checkstock", productHandler.CheckStockLevels)
 			productRoutes.POST("/checkstock/:id", productHandler.CheckStockLevel)
 			// productRoutes.POST("/updateStock/:id", productHandler.UpdateStockLevel) //no longer needed as it is handeld by rabbitmq
 
@@ -70,7 +72,7 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	product := mapper.MapProductToRequest(&productRequest, productID, variantIDs)
 
 	// Save the product to the database
-	if err := h.repo.CreateProduct(&product); err != nil {
+	if err := h.repo.CreateProduct(&product, actor(c)); err != nil {
 		h.logger.Error("failed to create product", zap.Error(err))
 		c.JSON(500, gin.H{"error": "failed to create product"})
 		return
@@ -165,7 +167,19 @@ func (h *ProductHandler) CheckStockLevel(c *gin.Context) {
 
 	quantity := quantityRequest.Quantity
 
-	stockLevel, price, err := h.repo.CheckStockLevel(variantID, quantity)
+	stockLevel, price, err := h.repo.CheckStockLevel(variantID, quantity, quantityRequest.Currency)
+	if errors.Is(err, repository.ErrVariantNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Variant not found"})
+		return
+	}
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		c.JSON(http.StatusConflict, gin.H{"message": "Insufficient stock", "stock_level": stockLevel})
+		return
+	}
+	if errors.Is(err, repository.ErrRateNotFound) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Currency not supported"})
+		return
+	}
 	if err != nil {
 		h.logger.Error("error checking stock leveles", zap.Error(err), zap.String("variant_id", variantID))
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error checking stock level", "error": err.Error()})
@@ -175,6 +189,31 @@ func (h *ProductHandler) CheckStockLevel(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"stock_level": stockLevel, "price": price})
 }
 
+// checks the availability, stock and price of up to 100 variants in one call. Atomic checks also report
+// whether all items could be ordered together, which is not a reservation
+func (h *ProductHandler) CheckStockLevels(c *gin.Context) {
+	var checkRequest request.CheckStockRequest
+	if err := c.ShouldBindJSON(&checkRequest); err != nil {
+		h.logger.Error("failed to bind request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+		return
+	}
+
+	variantIDs := make([]string, 0, len(checkRequest.Items))
+	for _, item := range checkRequest.Items {
+		variantIDs = append(variantIDs, item.VariantID)
+	}
+
+	levels, err := h.repo.CheckStockLevels(variantIDs, checkRequest.Currency)
+	if err != nil {
+		h.logger.Error("error checking stock levels", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error checking stock levels"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapper.MapStockLevelsToResponse(&checkRequest, levels))
+}
+
 // func (h *ProductHandler) UpdateStockLevel(c *gin.Context) {
 // 	var quantityRequest request.UpdateQuantityRequest
 // 	h.logger.Info("Updating stock level")
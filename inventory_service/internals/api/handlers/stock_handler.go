@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palashbhasme/ecommerce_microservices/common/middlewares"
+	"github.com/palashbhasme/ecommerce_microservices/common/models"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/dto/request"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/repository"
+	"go.uber.org/zap"
+)
+
+type StockHandler struct {
+	repo   repository.StockMovementRepository
+	logger *zap.Logger
+}
+
+func NewStockHandler(router *gin.Engine, repo repository.StockMovementRepository, logger *zap.Logger) {
+	stockHandler := &StockHandler{
+		repo:   repo,
+		logger: logger,
+	}
+	authconfig := models.NewAuthConfig(os.Getenv("JWT_SECRET"))
+	api := router.Group("/api")
+	{
+		stockRoutes := api.Group("/stock/v1")
+		stockRoutes.Use(middlewares.AuthMiddleware(*authconfig))
+		stockRoutes.Use(middlewares.AdminMiddleware())
+		{
+			stockRoutes.GET("/movements", stockHandler.GetStockMovements)
+			stockRoutes.GET("/variants/:id/movements", stockHandler.GetVariantMovements)
+			stockRoutes.POST("/variants/:id/adjust", stockHandler.AdjustStock)
+			stockRoutes.GET("/reconcile", stockHandler.ReconcileStock)
+		}
+	}
+}
+
+// lists the stock ledger newest first, filtered by variant, kind and time range
+func (h *StockHandler) GetStockMovements(c *gin.Context) {
+	var listRequest request.ListMovementsRequest
+	if err := c.ShouldBindQuery(&listRequest); err != nil {
+		h.logger.Error("failed to bind query", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters"})
+		return
+	}
+	h.listMovements(c, &listRequest)
+}
+
+func (h *StockHandler) GetVariantMovements(c *gin.Context) {
+	var listRequest request.ListMovementsRequest
+	if err := c.ShouldBindQuery(&listRequest); err != nil {
+		h.logger.Error("failed to bind query", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters"})
+		return
+	}
+	listRequest.VariantID = c.Param("id")
+	h.listMovements(c, &listRequest)
+}
+
+func (h *StockHandler) listMovements(c *gin.Context, listRequest *request.ListMovementsRequest) {
+	if !listRequest.From.IsZero() && !listRequest.To.IsZero() && !listRequest.To.After(listRequest.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "to has to be after from"})
+		return
+	}
+
+	query := mapper.MapMovementQuery(listRequest)
+	movements, total, err := h.repo.GetStockMovements(query)
+	if err != nil {
+		h.logger.Error("failed to get stock movements", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get stock movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapper.MapMovementsToResponse(movements, query, total))
+}
+
+// changes the on-hand stock of a variant by hand, the change is booked as an adjustment
+func (h *StockHandler) AdjustStock(c *gin.Context) {
+	variantID := c.Param("id")
+
+	var adjustRequest request.AdjustStockRequest
+	if err := c.ShouldBindJSON(&adjustRequest); err != nil {
+		h.logger.Error("failed to bind request body", zap.Error(err), zap.String("variant_id", variantID))
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+		return
+	}
+
+	movement, err := h.repo.AdjustStock(variantID, adjustRequest.Delta, adjustRequest.Reason, actor(c))
+	if errors.Is(err, repository.ErrVariantNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Variant not found"})
+		return
+	}
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		c.JSON(http.StatusConflict, gin.H{"message": "Stock cannot go below what orders hold", "error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to adjust stock", zap.Error(err), zap.String("variant_id", variantID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to adjust stock"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"movement": mapper.MapMovementToResponse(movement)})
+}
+
+// recomputes stock and reservations from the ledger and lists the variants that do not add up,
+// a single variant is checked with ?variant_id
+func (h *StockHandler) ReconcileStock(c *gin.Context) {
+	variantID := c.Query("variant_id")
+
+	discrepancies, err := h.repo.ReconcileStock(variantID)
+	if err != nil {
+		h.logger.Error("failed to reconcile stock", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reconcile stock"})
+		return
+	}
+	if len(discrepancies) > 0 {
+		h.logger.Warn("stock does not match the ledger", zap.Int("variants", len(discrepancies)))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"consistent":    len(discrepancies) == 0,
+		"discrepancies": mapper.MapDiscrepanciesToResponse(discrepancies),
+	})
+}
+
+// actor names the logged in user for the stock ledger
+func actor(c *gin.Context) string {
+	claims, exists := c.Get("user")
+	if !exists {
+		return "unknown"
+	}
+	userClaims, ok := claims.(*models.Claims)
+	if !ok || userClaims.Subject == "" {
+		return "unknown"
+	}
+	return userClaims.Subject
+}
@@ -2,9 +2,11 @@ package rabbitmq
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/palashbhasme/ecommerce_microservices/common"
 	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/repository"
@@ -14,18 +16,21 @@ import (
 
 // InventoryRequest struct
 type Inventory struct {
-	OrderID string      `json:"order_id"`
-	Items   []OrderItem `json:"order_items"`
+	OrderID  string      `json:"order_id"`
+	Source   string      `json:"source,omitempty"`   // What a restock is for, e.g. "return/<id>"
+	Currency string      `json:"currency,omitempty"` // Prices are reported in this currency
+	Items    []OrderItem `json:"order_items"`
 }
 
 // OrderItemReq struct
 type OrderItem struct {
-	ProductID string  `json:"product_id" binding:"required,uuid"`
-	Price     float64 `json:"price" binding:"required,gt=0"`
-	Quantity  int     `json:"quantity" binding:"required,gt=0"`
+	ProductID string        `json:"product_id" binding:"required,uuid"`
+	Price     *common.Money `json:"price,omitempty"` // Quote sent by the client, not used for pricing
+	Quantity  int           `json:"quantity" binding:"required,gt=0"`
 }
 
-func InventoryCheckConsumer(logger *zap.Logger, repo repository.PostgresRepository, conn *amqp.Connection) error {
+// InventoryCheckConsumer reserves stock for new orders, the reservation is held for ttl until the order is paid
+func InventoryCheckConsumer(logger *zap.Logger, repo repository.ProductRepository, conn *amqp.Connection, ttl time.Duration) error {
 
 	// Open a channel
 	client, err := common.NewRabbitMQClient(conn)
@@ -72,6 +77,14 @@ func InventoryCheckConsumer(logger *zap.Logger, repo repository.PostgresReposito
 			var request Inventory
 			if err := json.Unmarshal(msg.Body, &request); err != nil {
 				logger.Error("failed to parse message", zap.Error(err))
+				msg.Nack(false, false)
+				continue
+			}
+
+			// Deduplication is keyed on the message id, a message without one cannot be processed safely
+			if msg.MessageId == "" {
+				logger.Error("message has no message id", zap.String("OrderID", request.OrderID))
+				msg.Nack(false, false)
 				continue
 			}
 
@@ -83,22 +96,60 @@ func InventoryCheckConsumer(logger *zap.Logger, repo repository.PostgresReposito
 				quantities = append(quantities, item.Quantity)
 			}
 
-			// Call DecrementStockLevel and check error
-			available, totalPrice, err := repo.DecrementStockLevel(variantIDs, quantities)
+			// Call ReserveStock and check error
+			available, reserved, totalPrice, err := repo.ReserveStock(msg.MessageId, request.OrderID, variantIDs, quantities, request.Currency, ttl)
+			if errors.Is(err, common.ErrDuplicateMessage) {
+				logger.Info("skipping already processed inventory check", zap.String("OrderID", request.OrderID), zap.String("MessageID", msg.MessageId))
+				msg.Ack(false)
+				continue
+			}
+			if errors.Is(err, common.ErrCurrencyMismatch) {
+				logger.Warn("order mixes variants priced in different currencies", zap.String("OrderID", request.OrderID), zap.Error(err))
+				msg.Ack(false)
+				UpdateOrderPublisher(UpdateOrder{OrderID: request.OrderID, Status: "cancelled", Reason: "variants priced in different currencies"}, logger, conn)
+				continue
+			}
+			if errors.Is(err, repository.ErrRateNotFound) {
+				logger.Warn("no exchange rate for order currency", zap.String("OrderID", request.OrderID), zap.Error(err))
+				msg.Ack(false)
+				UpdateOrderPublisher(UpdateOrder{OrderID: request.OrderID, Status: "cancelled", Reason: "currency not supported"}, logger, conn)
+				continue
+			}
+			if errors.Is(err, repository.ErrVariantNotFound) {
+				logger.Warn("order references unknown variant", zap.String("OrderID", request.OrderID), zap.Error(err))
+				msg.Ack(false)
+				UpdateOrderPublisher(UpdateOrder{OrderID: request.OrderID, Status: "cancelled", Reason: "unknown product variant"}, logger, conn)
+				continue
+			}
 			if err != nil {
-				logger.Error("error updating stock levels", zap.Error(err))
+				logger.Error("error reserving stock", zap.Error(err))
 				msg.Nack(false, true)
 				continue
 			}
 
 			if available {
-				logger.Info("Stock available", zap.String("OrderID", request.OrderID), zap.Float64("TotalPrice", totalPrice))
+				logger.Info("Stock available", zap.String("OrderID", request.OrderID), zap.String("TotalPrice", totalPrice.String()))
 				msg.Ack(false)
-				UpdateOrderPublisher(request.OrderID, "confirmed", logger, conn)
+				pricedItems := make([]PricedItem, len(reserved))
+				for i, item := range reserved {
+					pricedItems[i] = PricedItem{
+						ProductID:       item.VariantID,
+						UnitPrice:       item.UnitPrice,
+						ParentProductID: item.ProductID,
+						CategoryID:      item.CategoryID,
+					}
+				}
+				UpdateOrderPublisher(UpdateOrder{
+					OrderID:     request.OrderID,
+					Status:      "confirmed",
+					Reason:      "stock available",
+					TotalAmount: &totalPrice,
+					Items:       pricedItems,
+				}, logger, conn)
 			} else {
 				logger.Warn("Stock not available for one or more products", zap.String("OrderID", request.OrderID))
 				msg.Ack(false)
-				UpdateOrderPublisher(request.OrderID, "cancelled", logger, conn)
+				UpdateOrderPublisher(UpdateOrder{OrderID: request.OrderID, Status: "cancelled", Reason: "insufficient stock"}, logger, conn)
 			}
 		}
 	}()
@@ -109,3 +160,265 @@ func InventoryCheckConsumer(logger *zap.Logger, repo repository.PostgresReposito
 
 	return nil
 }
+
+// StockReleaseConsumer listens for cancelled orders and gives their reserved or taken stock back
+func StockReleaseConsumer(logger *zap.Logger, repo repository.ProductRepository, conn *amqp.Connection) error {
+
+	client, err := common.NewRabbitMQClient(conn)
+	if err != nil {
+		logger.Error("Failed to get a client", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateExchange("stock_release", "direct", true, false, false, false)
+	if err != nil {
+		logger.Error("Failed to declare exchange", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateQueue("stock_release", true, false)
+	if err != nil {
+		logger.Error("error declaring queue", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateBinding("stock_release", "stock_release_key", "stock_release")
+	if err != nil {
+		logger.Error("error binding queue", zap.Error(err))
+		return err
+	}
+
+	defer client.Close()
+
+	msgs, err := client.Consume("stock_release", "stock_release_consumer", false)
+	if err != nil {
+		logger.Error("failed to start consuming messages", zap.Error(err))
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for msg := range msgs {
+			var request Inventory
+			if err := json.Unmarshal(msg.Body, &request); err != nil {
+				logger.Error("failed to parse message", zap.Error(err))
+				msg.Nack(false, false)
+				continue
+			}
+
+			if msg.MessageId == "" {
+				logger.Error("message has no message id", zap.String("OrderID", request.OrderID))
+				msg.Nack(false, false)
+				continue
+			}
+
+			var variantIDs []string
+			var quantities []int
+			for _, item := range request.Items {
+				variantIDs = append(variantIDs, item.ProductID)
+				quantities = append(quantities, item.Quantity)
+			}
+
+			err := repo.ReleaseStock(msg.MessageId, request.OrderID, variantIDs, quantities)
+			if errors.Is(err, common.ErrDuplicateMessage) {
+				logger.Info("skipping already processed stock release", zap.String("OrderID", request.OrderID), zap.String("MessageID", msg.MessageId))
+				msg.Ack(false)
+				continue
+			}
+			if err != nil {
+				logger.Error("error releasing stock", zap.Error(err), zap.String("OrderID", request.OrderID))
+				msg.Nack(false, true)
+				continue
+			}
+
+			logger.Info("Stock released", zap.String("OrderID", request.OrderID))
+			msg.Ack(false)
+		}
+	}()
+
+	<-sigChan // Wait for termination signal
+
+	logger.Info("Shutting down stock release consumer...")
+
+	return nil
+}
+
+// StockCommitConsumer listens for paid orders and takes their reserved stock off the on-hand stock
+func StockCommitConsumer(logger *zap.Logger, repo repository.ProductRepository, conn *amqp.Connection) error {
+
+	client, err := common.NewRabbitMQClient(conn)
+	if err != nil {
+		logger.Error("Failed to get a client", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateExchange("stock_commit", "direct", true, false, false, false)
+	if err != nil {
+		logger.Error("Failed to declare exchange", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateQueue("stock_commit", true, false)
+	if err != nil {
+		logger.Error("error declaring queue", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateBinding("stock_commit", "stock_commit_key", "stock_commit")
+	if err != nil {
+		logger.Error("error binding queue", zap.Error(err))
+		return err
+	}
+
+	defer client.Close()
+
+	msgs, err := client.Consume("stock_commit", "stock_commit_consumer", false)
+	if err != nil {
+		logger.Error("failed to start consuming messages", zap.Error(err))
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for msg := range msgs {
+			var request Inventory
+			if err := json.Unmarshal(msg.Body, &request); err != nil {
+				logger.Error("failed to parse message", zap.Error(err))
+				msg.Nack(false, false)
+				continue
+			}
+
+			if msg.MessageId == "" {
+				logger.Error("message has no message id", zap.String("OrderID", request.OrderID))
+				msg.Nack(false, false)
+				continue
+			}
+
+			err := repo.CommitReservations(msg.MessageId, request.OrderID)
+			if errors.Is(err, common.ErrDuplicateMessage) {
+				logger.Info("skipping already processed stock commit", zap.String("OrderID", request.OrderID), zap.String("MessageID", msg.MessageId))
+				msg.Ack(false)
+				continue
+			}
+			if errors.Is(err, repository.ErrReservationExpired) {
+				// The holds were released because the order was cancelled, there is nothing left to commit
+				logger.Error("stock commit for order without active reservation", zap.String("OrderID", request.OrderID))
+				msg.Nack(false, false)
+				continue
+			}
+			if errors.Is(err, repository.ErrInsufficientStock) {
+				// Holds keep reserved stock available, less on hand means it was changed around them
+				logger.Error("stock commit would oversell", zap.Error(err), zap.String("OrderID", request.OrderID))
+				msg.Nack(false, false)
+				continue
+			}
+			if err != nil {
+				logger.Error("error committing stock", zap.Error(err), zap.String("OrderID", request.OrderID))
+				msg.Nack(false, true)
+				continue
+			}
+
+			logger.Info("Stock committed", zap.String("OrderID", request.OrderID))
+			msg.Ack(false)
+		}
+	}()
+
+	<-sigChan // Wait for termination signal
+
+	logger.Info("Shutting down stock commit consumer...")
+
+	return nil
+}
+
+// StockRestockConsumer listens for refunded or returned items and puts them back on stock
+func StockRestockConsumer(logger *zap.Logger, repo repository.ProductRepository, conn *amqp.Connection) error {
+
+	client, err := common.NewRabbitMQClient(conn)
+	if err != nil {
+		logger.Error("Failed to get a client", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateExchange("stock_restock", "direct", true, false, false, false)
+	if err != nil {
+		logger.Error("Failed to declare exchange", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateQueue("stock_restock", true, false)
+	if err != nil {
+		logger.Error("error declaring queue", zap.Error(err))
+		return err
+	}
+
+	err = client.CreateBinding("stock_restock", "stock_restock_key", "stock_restock")
+	if err != nil {
+		logger.Error("error binding queue", zap.Error(err))
+		return err
+	}
+
+	defer client.Close()
+
+	msgs, err := client.Consume("stock_restock", "stock_restock_consumer", false)
+	if err != nil {
+		logger.Error("failed to start consuming messages", zap.Error(err))
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for msg := range msgs {
+			var request Inventory
+			if err := json.Unmarshal(msg.Body, &request); err != nil {
+				logger.Error("failed to parse message", zap.Error(err))
+				msg.Nack(false, false)
+				continue
+			}
+
+			if msg.MessageId == "" {
+				logger.Error("message has no message id", zap.String("OrderID", request.OrderID))
+				msg.Nack(false, false)
+				continue
+			}
+
+			var variantIDs []string
+			var quantities []int
+			for _, item := range request.Items {
+				variantIDs = append(variantIDs, item.ProductID)
+				quantities = append(quantities, item.Quantity)
+			}
+
+			// Restocks published before the source was sent are booked against the order
+			source := request.Source
+			if source == "" {
+				source = request.OrderID
+			}
+			err := repo.RestockItems(msg.MessageId, source, variantIDs, quantities)
+			if errors.Is(err, common.ErrDuplicateMessage) {
+				logger.Info("skipping already processed stock restock", zap.String("OrderID", request.OrderID), zap.String("MessageID", msg.MessageId))
+				msg.Ack(false)
+				continue
+			}
+			if err != nil {
+				logger.Error("error restocking items", zap.Error(err), zap.String("OrderID", request.OrderID))
+				msg.Nack(false, true)
+				continue
+			}
+
+			logger.Info("Stock restocked", zap.String("OrderID", request.OrderID))
+			msg.Ack(false)
+		}
+	}()
+
+	<-sigChan // Wait for termination signal
+
+	logger.Info("Shutting down stock restock consumer...")
+
+	return nil
+}
@@ -4,21 +4,37 @@ import (
 	"context"
 	"encoding/json"
 
+	"github.com/google/uuid"
 	"github.com/palashbhasme/ecommerce_microservices/common"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
 )
 
 type UpdateOrder struct {
-	OrderID string `json:"order_id" binding:"required"`
-	Status  string `json:"status" binding:"required"`
+	OrderID     string        `json:"order_id" binding:"required"`
+	Status      string        `json:"status" binding:"required"`
+	Reason      string        `json:"reason,omitempty"`
+	TotalAmount *common.Money `json:"total_amount,omitempty"`
+	Items       []PricedItem  `json:"order_items,omitempty"` // Catalog prices, set when stock was confirmed
+	// Set by the reservation sweeper, order_service only cancels orders for it that are not paid yet
+	ReservationExpired bool `json:"reservation_expired,omitempty"`
 }
 
-func UpdateOrderPublisher(orderId string, status string, logger *zap.Logger, conn *amqp.Connection) {
+// PricedItem carries the authoritative unit price of an ordered variant and where it sits in the catalog
+type PricedItem struct {
+	ProductID       string       `json:"product_id"` // Variant id, named after the order item field
+	UnitPrice       common.Money `json:"unit_price"`
+	ParentProductID string       `json:"parent_product_id,omitempty"`
+	CategoryID      string       `json:"category_id,omitempty"`
+}
+
+// UpdateOrderPublisher sends a status update for an order to order_service, the error is already logged
+func UpdateOrderPublisher(order UpdateOrder, logger *zap.Logger, conn *amqp.Connection) error {
 	// Open a channel
 	client, err := common.NewRabbitMQClient(conn)
 	if err != nil {
 		logger.Error("Failed to get a client", zap.Error(err))
+		return err
 	}
 	defer client.Close()
 
@@ -39,22 +55,21 @@ func UpdateOrderPublisher(orderId string, status string, logger *zap.Logger, con
 		logger.Error("error binding queue", zap.Error(err))
 	}
 
-	order := UpdateOrder{
-		OrderID: orderId,
-		Status:  status,
-	}
-
 	body, err := json.Marshal(order)
 	if err != nil {
 		logger.Error("Failed to marshal JSON", zap.Error(err))
+		return err
 	}
 	err = client.Send(context.TODO(), "order_update", "order_update_key", amqp.Publishing{
 		ContentType: "application/json",
+		MessageId:   uuid.New().String(),
+		AppId:       "inventory_service",
 		Body:        body,
 	})
 
 	if err != nil {
 		logger.Error("Failed to publish message", zap.Error(err))
+		return err
 	}
 
 	logger.Info("Successfully published update order request",
@@ -62,4 +77,5 @@ func UpdateOrderPublisher(orderId string, status string, logger *zap.Logger, con
 		zap.String("routing_key", "update_order_key"),
 		zap.String("order_id", order.OrderID),
 	)
+	return nil
 }
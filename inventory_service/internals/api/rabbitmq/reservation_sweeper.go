@@ -0,0 +1,44 @@
+package rabbitmq
+
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/repository"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+const sweepBatchSize = 100
+
+// ReservationSweeper expires stock reservations of orders that were not paid in time and cancels those orders.
+// The cancellation is published before the holds are expired, if publishing fails the order is retried next sweep.
+// An order can be paid while its stock commit is still on the way, order_service keeps such orders and the
+// commit takes the stock of the expired holds
+func ReservationSweeper(logger *zap.Logger, repo repository.ReservationRepository, conn *amqp.Connection, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		orderIDs, err := repo.GetExpiredReservationOrders(now, sweepBatchSize)
+		if err != nil {
+			logger.Error("error fetching expired reservations", zap.Error(err))
+			continue
+		}
+
+		for _, orderID := range orderIDs {
+			err := UpdateOrderPublisher(UpdateOrder{OrderID: orderID, Status: "cancelled", Reason: "reservation expired", ReservationExpired: true}, logger, conn)
+			if err != nil {
+				continue
+			}
+
+			expired, err := repo.ExpireReservations(orderID, now)
+			if err != nil {
+				logger.Error("error expiring reservations", zap.Error(err), zap.String("OrderID", orderID))
+				continue
+			}
+			logger.Info("Reservations expired", zap.String("OrderID", orderID), zap.Int64("count", expired))
+		}
+	}
+	return nil
+}
@@ -1,7 +1,13 @@
 package api
 
 import (
+	"os"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/palashbhasme/ecommerce_microservices/common"
 	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/handlers"
 	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/api/rabbitmq"
 	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/repository"
@@ -16,14 +22,43 @@ func RunServer(logger *zap.Logger, db *gorm.DB, rabbitmqconfig *rabbitmq.RabbitM
 		logger.Error("Failed to connect to rabbit mq", zap.Error(err))
 	}
 	repo := repository.NewPostgresRepository(db)
+
+	// Stock is held for an order until it is paid or the reservation expires
+	reservationTTL := 15 * time.Minute
+	if ttl, err := time.ParseDuration(os.Getenv("RESERVATION_TTL")); err == nil && ttl > 0 {
+		reservationTTL = ttl
+	}
+
 	go func() {
-		err = rabbitmq.InventoryCheckConsumer(logger, *repo, conn.Conn)
+		err := rabbitmq.InventoryCheckConsumer(logger, repo, conn.Conn, reservationTTL)
 		logger.Error("consume inventory check stopped", zap.Error(err))
 	}()
+	go func() {
+		err := rabbitmq.StockReleaseConsumer(logger, repo, conn.Conn)
+		logger.Error("consume stock release stopped", zap.Error(err))
+	}()
+	go func() {
+		err := rabbitmq.StockCommitConsumer(logger, repo, conn.Conn)
+		logger.Error("consume stock commit stopped", zap.Error(err))
+	}()
+	go func() {
+		err := rabbitmq.StockRestockConsumer(logger, repo, conn.Conn)
+		logger.Error("consume stock restock stopped", zap.Error(err))
+	}()
+	go func() {
+		err := rabbitmq.ReservationSweeper(logger, repo, conn.Conn, time.Minute)
+		logger.Error("reservation sweeper stopped", zap.Error(err))
+	}()
 
+	// Money fields are validated by their amount, so binding tags like gt=0 work on prices
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterCustomTypeFunc(common.MoneyAmount, common.Money{})
+	}
 	router := gin.Default()
 	handlers.NewCategoryHandler(router, repo, logger)
 	handlers.NewProductHandler(router, repo, logger)
+	handlers.NewExchangeRateHandler(router, repo, logger)
+	handlers.NewStockHandler(router, repo, logger)
 
 	err = router.Run(":8081")
 	if err != nil {
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// ExchangeRate says how many units of QuoteCurrency one unit of BaseCurrency buys
+type ExchangeRate struct {
+	BaseCurrency  string    `gorm:"type:char(3);primaryKey"`
+	QuoteCurrency string    `gorm:"type:char(3);primaryKey"`
+	Rate          float64   `gorm:"type:decimal(18,8);not null"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/palashbhasme/ecommerce_microservices/common"
 	"gorm.io/gorm"
 )
 
@@ -29,22 +30,28 @@ type Product struct {
 }
 
 type ProductVariant struct {
-	ID            string    `gorm:"type:uuid;primaryKey"`
-	ProductID     string    `gorm:"type:uuid;not null"`
-	Color         string    `gorm:"type:varchar(100)"`
-	Size          string    `gorm:"type:varchar(50)"`
-	Price         *float64  `gorm:"type:decimal(10,2);not null"`
-	StockQuantity int       `gorm:"default:0"`
-	SKU           string    `gorm:"type:varchar(100);unique;not null"`
-	CreatedAt     time.Time `gorm:"autoCreateTime"`
-	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+	ID            string       `gorm:"type:uuid;primaryKey"`
+	ProductID     string       `gorm:"type:uuid;not null"`
+	Color         string       `gorm:"type:varchar(100)"`
+	Size          string       `gorm:"type:varchar(50)"`
+	Price         common.Money `gorm:"embedded;embeddedPrefix:price_"`
+	StockQuantity int          `gorm:"default:0"`
+	SKU           string       `gorm:"type:varchar(100);unique;not null"`
+	CreatedAt     time.Time    `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time    `gorm:"autoUpdateTime"`
 }
 
 func AutoMigrate(db *gorm.DB) error {
-	err := db.AutoMigrate(&Category{}, &Product{}, &ProductVariant{})
+	err := db.AutoMigrate(&Category{}, &Product{}, &ProductVariant{}, &ExchangeRate{}, &StockReservation{}, &StockMovement{})
 	if err != nil {
 		return err
 	}
+	if err := common.MigrateMoneyColumns(db, "product_variants", "price"); err != nil {
+		return err
+	}
+	if err := common.MigrateInbox(db); err != nil {
+		return err
+	}
 	// Now create the trigger
 	triggerSQL := `
 		DROP TRIGGER IF EXISTS 	stock_update on product_variants;
@@ -83,5 +90,36 @@ func AutoMigrate(db *gorm.DB) error {
 	if err := db.Exec(triggerSQL).Error; err != nil {
 		return err
 	}
-	return nil
+
+	// Ledger entries are only ever added, corrections are new movements
+	appendOnlySQL := `
+		CREATE OR REPLACE FUNCTION reject_stock_movement_change()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			RAISE EXCEPTION 'stock movements are append only';
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS stock_movements_append_only ON stock_movements;
+
+		CREATE TRIGGER stock_movements_append_only
+		BEFORE UPDATE OR DELETE
+		ON stock_movements
+		FOR EACH ROW
+		EXECUTE FUNCTION reject_stock_movement_change();
+		`
+	if err := db.Exec(appendOnlySQL).Error; err != nil {
+		return err
+	}
+
+	// Variants without any movement predate the ledger, their current stock and holds open it
+	openingSQL := `
+		INSERT INTO stock_movements (variant_id, kind, delta, reserved_delta, reason, reference_id, actor, created_at)
+		SELECT v.id, ?, COALESCE(v.stock_quantity, 0),
+			COALESCE((SELECT SUM(r.quantity) FROM stock_reservations r WHERE r.variant_id = v.id AND r.status = ?), 0),
+			'stock before the ledger was started', v.id::text, 'migration', now()
+		FROM product_variants v
+		WHERE NOT EXISTS (SELECT 1 FROM stock_movements m WHERE m.variant_id = v.id)
+		`
+	return db.Exec(openingSQL, MovementOpening, ReservationActive).Error
 }
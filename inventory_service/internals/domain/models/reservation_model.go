@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type ReservationStatus string
+
+const (
+	ReservationActive    ReservationStatus = "active"    // Held for the order, counts against available stock
+	ReservationCommitted ReservationStatus = "committed" // Order was paid, the quantity left on-hand stock
+	ReservationReleased  ReservationStatus = "released"  // Order was cancelled before the hold expired
+	ReservationExpired   ReservationStatus = "expired"   // Hold ran out before the order was paid
+)
+
+// StockReservation holds a quantity of a variant for an order until it is committed, released or expires.
+// Available stock is the on-hand stock quantity minus all active reservations
+type StockReservation struct {
+	ID        string            `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	OrderID   string            `gorm:"type:uuid;not null;index"`
+	VariantID string            `gorm:"type:uuid;not null;index:idx_reservation_variant_status"`
+	Quantity  int               `gorm:"not null"`
+	Status    ReservationStatus `gorm:"type:varchar(20);not null;index:idx_reservation_variant_status"`
+	ExpiresAt time.Time         `gorm:"not null;index"`
+	CreatedAt time.Time         `gorm:"autoCreateTime"`
+	UpdatedAt time.Time         `gorm:"autoUpdateTime"`
+}
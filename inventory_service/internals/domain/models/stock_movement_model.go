@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type MovementKind string
+
+const (
+	MovementOpening     MovementKind = "opening"     // Stock a variant had when the ledger was started
+	MovementAdjustment  MovementKind = "adjustment"  // Changed by hand, including the stock a variant is created with
+	MovementOrder       MovementKind = "order"       // A paid order took its reserved stock
+	MovementRestock     MovementKind = "restock"     // Stock of cancelled or refunded orders put back
+	MovementReturn      MovementKind = "return"      // Returned items put back
+	MovementReservation MovementKind = "reservation" // Stock held for an order or given back, on-hand stock is unchanged
+)
+
+// StockMovements Model, the append only ledger of stock changes. It is written in the transaction that changes
+// the stock, so summing the deltas of a variant gives its on-hand stock and the stock held for orders
+type StockMovement struct {
+	ID            string       `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	VariantID     string       `gorm:"type:uuid;not null;index:idx_movement_variant_time"`
+	Kind          MovementKind `gorm:"type:varchar(20);not null"`
+	Delta         int          `gorm:"not null"` // Change of the on-hand stock
+	ReservedDelta int          `gorm:"not null"` // Change of the stock held by active reservations
+	Reason        string       `gorm:"type:text"`
+	ReferenceID   string       `gorm:"type:varchar(64);index"` // Order, product or return the change belongs to
+	Actor         string       `gorm:"type:varchar(255);not null"`
+	CreatedAt     time.Time    `gorm:"autoCreateTime;index:idx_movement_variant_time"`
+}
+
+// StockDiscrepancy is a variant whose stock does not match what its ledger adds up to
+type StockDiscrepancy struct {
+	VariantID      string
+	StockQuantity  int // On hand according to the variant
+	LedgerStock    int
+	Reserved       int // Held by active reservations
+	LedgerReserved int
+}
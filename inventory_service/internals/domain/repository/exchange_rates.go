@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRateNotFound is returned when no exchange rate is known between two currencies
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// RateProvider returns how many units of quote one unit of base buys.
+// The repository reads rates from its exchange_rates table unless another provider is plugged in
+type RateProvider interface {
+	GetExchangeRate(base, quote string) (float64, error)
+}
+
+// SetRateProvider replaces the table backed rates used to price orders in other currencies
+func (r *PostgresRepository) SetRateProvider(provider RateProvider) {
+	r.rates = provider
+}
+
+// GetExchangeRate looks up the rate for base to quote, falling back to the inverse of quote to base
+func (r *PostgresRepository) GetExchangeRate(base, quote string) (float64, error) {
+	base, quote = strings.ToUpper(base), strings.ToUpper(quote)
+	if base == quote {
+		return 1, nil
+	}
+
+	var rates []models.ExchangeRate
+	err := r.db.Where("(base_currency = ? AND quote_currency = ?) OR (base_currency = ? AND quote_currency = ?)",
+		base, quote, quote, base).Find(&rates).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rate := range rates {
+		if rate.BaseCurrency == base {
+			return rate.Rate, nil
+		}
+	}
+	for _, rate := range rates {
+		if rate.Rate > 0 {
+			return 1 / rate.Rate, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s to %s", ErrRateNotFound, base, quote)
+}
+
+func (r *PostgresRepository) GetAllExchangeRates() ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := r.db.Order("base_currency, quote_currency").Find(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// UpsertExchangeRate creates the rate or replaces the existing one for the currency pair
+func (r *PostgresRepository) UpsertExchangeRate(rate *models.ExchangeRate) error {
+	rate.BaseCurrency = strings.ToUpper(rate.BaseCurrency)
+	rate.QuoteCurrency = strings.ToUpper(rate.QuoteCurrency)
+
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(rate).Error
+}
+
+func (r *PostgresRepository) DeleteExchangeRate(base, quote string) error {
+	result := r.db.Where("base_currency = ? AND quote_currency = ?", strings.ToUpper(base), strings.ToUpper(quote)).
+		Delete(&models.ExchangeRate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// converter prices catalog amounts in a requested currency. Every exchange rate is looked up once,
+// an empty currency keeps the catalog currency
+type converter struct {
+	rates    RateProvider
+	currency string
+	lookups  map[string]rateLookup // Keyed by the catalog currency
+}
+
+type rateLookup struct {
+	rate float64
+	err  error
+}
+
+func (r *PostgresRepository) converter(currency string) *converter {
+	return &converter{rates: r.rates, currency: strings.ToUpper(currency), lookups: make(map[string]rateLookup)}
+}
+
+func (c *converter) convert(price common.Money) (common.Money, error) {
+	if c.currency == "" || strings.EqualFold(price.Currency, c.currency) {
+		return price, nil
+	}
+	base := strings.ToUpper(price.Currency)
+	lookup, ok := c.lookups[base]
+	if !ok {
+		lookup.rate, lookup.err = c.rates.GetExchangeRate(base, c.currency)
+		c.lookups[base] = lookup
+	}
+	if lookup.err != nil {
+		return common.Money{}, lookup.err
+	}
+	return price.Convert(c.currency, lookup.rate), nil
+}
@@ -1,18 +1,23 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/palashbhasme/ecommerce_microservices/common"
 	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
 	"gorm.io/gorm"
 )
 
 type PostgresRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	rates RateProvider
 }
 
 func NewPostgresRepository(db *gorm.DB) *PostgresRepository {
-	return &PostgresRepository{db: db}
+	repo := &PostgresRepository{db: db}
+	repo.rates = repo
+	return repo
 }
 
 func (r *PostgresRepository) CreateCategory(category *models.Category) error {
@@ -62,8 +67,25 @@ func (r *PostgresRepository) DeleteCategory(id string) error {
 	return nil
 }
 
-func (r *PostgresRepository) CreateProduct(product *models.Product) error {
-	return r.db.Create(product).Error
+// CreateProduct stores the product with its variants and books the stock they start with as adjustments
+func (r *PostgresRepository) CreateProduct(product *models.Product, actor string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		var movements []models.StockMovement
+		for _, variant := range product.Variants {
+			movements = append(movements, models.StockMovement{
+				VariantID:   variant.ID,
+				Kind:        models.MovementAdjustment,
+				Delta:       variant.StockQuantity,
+				Reason:      "initial stock",
+				ReferenceID: product.ID,
+				Actor:       actor,
+			})
+		}
+		return recordMovements(tx, movements...)
+	})
 }
 
 func (r *PostgresRepository) GetProductByID(id string) (*models.Product, error) {
@@ -110,7 +132,9 @@ func (r *PostgresRepository) GetProductsByCategoryName(categoryName string) ([]m
 	return products, nil
 }
 
-func (r *PostgresRepository) UpdateProduct(id string, product *models.Product) error {
+// UpdateProduct updates the product and its variants. Stock of existing variants only changes through AdjustStock so
+// the ledger sees it, variants that do not exist yet are created with their stock booked as an adjustment
+func (r *PostgresRepository) UpdateProduct(id string, product *models.Product, actor string) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		// Update the product
 		if err := tx.Model(&models.Product{}).Where("id = ?", id).Updates(product).Error; err != nil {
@@ -119,7 +143,17 @@ func (r *PostgresRepository) UpdateProduct(id string, product *models.Product) e
 
 		// Update or create variants
 		for _, variant := range product.Variants {
-			if err := tx.Save(&variant).Error; err != nil {
+			var existing int64
+			if err := tx.Model(&models.ProductVariant{}).Where("id = ?", variant.ID).Count(&existing).Error; err != nil {
+				return err
+			}
+			if existing == 0 {
+				if err := createVariant(tx, &variant, actor); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Omit("stock_quantity").Save(&variant).Error; err != nil {
 				return err
 			}
 		}
@@ -145,8 +179,25 @@ func (r *PostgresRepository) DeleteProduct(id string) error {
 	return nil
 }
 
-func (r *PostgresRepository) CreateProductVariant(variant *models.ProductVariant) error {
-	return r.db.Create(variant).Error
+// CreateProductVariant stores the variant and books the stock it starts with as an adjustment by the actor
+func (r *PostgresRepository) CreateProductVariant(variant *models.ProductVariant, actor string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return createVariant(tx, variant, actor)
+	})
+}
+
+func createVariant(tx *gorm.DB, variant *models.ProductVariant, actor string) error {
+	if err := tx.Create(variant).Error; err != nil {
+		return err
+	}
+	return recordMovements(tx, models.StockMovement{
+		VariantID:   variant.ID,
+		Kind:        models.MovementAdjustment,
+		Delta:       variant.StockQuantity,
+		Reason:      "initial stock",
+		ReferenceID: variant.ProductID,
+		Actor:       actor,
+	})
 }
 
 func (r *PostgresRepository) GetProductVariantByID(id string) (*models.ProductVariant, error) {
@@ -168,7 +219,8 @@ func (r *PostgresRepository) GetProductVariantsByProduct(productID string) ([]mo
 }
 
 func (r *PostgresRepository) UpdateProductVariant(id string, variant *models.ProductVariant) error {
-	err := r.db.Model(&models.ProductVariant{}).Where("id = ?", id).Updates(variant).Error
+	// Stock only changes through AdjustStock so the ledger sees it
+	err := r.db.Model(&models.ProductVariant{}).Where("id = ?", id).Omit("stock_quantity").Updates(variant).Error
 	if err != nil {
 		return err
 	}
@@ -183,7 +235,8 @@ func (r *PostgresRepository) DeleteProductVariant(id string) error {
 	return nil
 }
 
-func (r *PostgresRepository) CheckStockLevel(variantID string, quantity int) (int, *float64, error) {
+// CheckStockLevel returns the available stock of a variant and its price in the requested currency, or the catalog currency if empty
+func (r *PostgresRepository) CheckStockLevel(variantID string, quantity int, currency string) (int, *common.Money, error) {
 	var variant models.ProductVariant
 
 	// Query the product variant by its ID
@@ -191,64 +244,72 @@ func (r *PostgresRepository) CheckStockLevel(variantID string, quantity int) (in
 	if err != nil {
 		// Return 0 and the error if no variant is found
 		if err == gorm.ErrRecordNotFound {
-			return 0, nil, fmt.Errorf("variant not found")
+			return 0, nil, fmt.Errorf("%w: %s", ErrVariantNotFound, variantID)
 		}
 		return 0, nil, err
 	}
 
+	// Stock held for orders that are not paid yet is not available
+	reserved, err := reservedQuantity(r.db, variantID)
+	if err != nil {
+		return 0, nil, err
+	}
+	available := variant.StockQuantity - reserved
+
 	// Check if the available stock is sufficient
-	if variant.StockQuantity < quantity {
-		return variant.StockQuantity, nil, fmt.Errorf("insufficient stock, available: %d", variant.StockQuantity)
+	if available < quantity {
+		return available, nil, fmt.Errorf("%w, available: %d", ErrInsufficientStock, available)
+	}
+
+	price, err := r.converter(currency).convert(variant.Price)
+	if err != nil {
+		return available, nil, err
 	}
 
 	// Return the available stock level
-	return variant.StockQuantity, variant.Price, nil
+	return available, &price, nil
 }
 
-// DecrementStockLevel returns true and total price of all items in order if the order items are available in inventory else return false and 0
-func (r *PostgresRepository) DecrementStockLevel(variantIDs []string, quantities []int) (bool, float64, error) {
-	tx := r.db.Begin()
-	var totalPrice float64
+// StockLevel is the available stock of a variant and its price in the requested currency.
+// The price is nil when no exchange rate to the currency is known
+type StockLevel struct {
+	VariantID string
+	Available int
+	Price     *common.Money
+}
 
-	if len(variantIDs) != len(quantities) {
-		tx.Rollback()
-		return false, 0, fmt.Errorf("mismatch in variantIDs and quantities length")
+// CheckStockLevels returns the stock levels of the variants keyed by variant id. Stock and reservations of all
+// variants are read in one query, so the levels are a consistent snapshot. Unknown variants are left out
+func (r *PostgresRepository) CheckStockLevels(variantIDs []string, currency string) (map[string]StockLevel, error) {
+	var rows []struct {
+		VariantID string
+		Price     common.Money `gorm:"embedded;embeddedPrefix:price_"`
+		Available int
 	}
-
-	for i, variantID := range variantIDs {
-		var variant models.ProductVariant
-
-		// Fetch product variant
-		result := tx.Where("id = ?", variantID).First(&variant)
-		if result.Error != nil {
-			tx.Rollback()
-			if result.Error == gorm.ErrRecordNotFound {
-				return false, 0, fmt.Errorf("variant %s not found", variantID)
-			}
-			return false, 0, result.Error
-		}
-
-		// Check stock availability
-		if variant.StockQuantity < quantities[i] {
-			tx.Rollback()
-			return false, 0, nil //Return no error as stock is not available
-		}
-
-		// Deduct stock and calculate total price
-		variant.StockQuantity -= quantities[i]
-		totalPrice += float64(quantities[i]) * *variant.Price
-
-		// Save updated variant
-		if err := tx.Save(&variant).Error; err != nil {
-			tx.Rollback()
-			return false, 0, err
-		}
+	err := r.db.Model(&models.ProductVariant{}).
+		Select("product_variants.id AS variant_id, product_variants.price_minor, product_variants.price_currency, "+
+			"product_variants.stock_quantity - COALESCE(SUM(stock_reservations.quantity), 0) AS available").
+		Joins("LEFT JOIN stock_reservations ON stock_reservations.variant_id = product_variants.id AND stock_reservations.status = ?", models.ReservationActive).
+		Where("product_variants.id IN ?", variantIDs).
+		Group("product_variants.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		return false, 0, err
+	levels := make(map[string]StockLevel, len(rows))
+	prices := r.converter(currency)
+	for _, row := range rows {
+		level := StockLevel{VariantID: row.VariantID, Available: row.Available}
+		price, err := prices.convert(row.Price)
+		switch {
+		case errors.Is(err, ErrRateNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			level.Price = &price
+		}
+		levels[row.VariantID] = level
 	}
-
-	return true, totalPrice, nil
+	return levels, nil
 }
@@ -1,9 +1,19 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
 	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
 )
 
+// ErrVariantNotFound is returned when an order references a variant that does not exist
+var ErrVariantNotFound = errors.New("variant not found")
+
+// ErrInsufficientStock is returned when a variant has less stock than requested
+var ErrInsufficientStock = errors.New("insufficient stock")
+
 type CategoryRepository interface {
 	CreateCategory(category *models.Category) error
 	GetCategoryByID(id string) (*models.Category, error)
@@ -14,21 +24,43 @@ type CategoryRepository interface {
 }
 
 type ProductRepository interface {
-	CreateProduct(product *models.Product) error
+	CreateProduct(product *models.Product, actor string) error
 	GetProductByID(id string) (*models.Product, error)
 	GetAllProducts() ([]models.Product, error)
 	GetProductsByCategoryID(categoryID string) ([]models.Product, error)
 	GetProductsByCategoryName(categoryName string) ([]models.Product, error)
-	UpdateProduct(id string, product *models.Product) error
+	UpdateProduct(id string, product *models.Product, actor string) error
 	DeleteProduct(id string) error
-	CheckStockLevel(variantID string, quantity int) (int, *float64, error)
-	DecrementStockLevel(variantID []string, quantity []int) (bool, float64, error) //rabbit mq functions
+	CheckStockLevel(variantID string, quantity int, currency string) (int, *common.Money, error)
+	CheckStockLevels(variantIDs []string, currency string) (map[string]StockLevel, error)
+	ReserveStock(messageID, orderID string, variantID []string, quantity []int, currency string, ttl time.Duration) (bool, []ReservedItem, common.Money, error) //rabbit mq functions
+	CommitReservations(messageID, orderID string) error
+	ReleaseStock(messageID, orderID string, variantID []string, quantity []int) error
+	RestockItems(messageID, source string, variantID []string, quantity []int) error
+}
+
+type StockMovementRepository interface {
+	GetStockMovements(query MovementQuery) ([]models.StockMovement, int64, error)
+	AdjustStock(variantID string, delta int, reason, actor string) (*models.StockMovement, error)
+	ReconcileStock(variantID string) ([]models.StockDiscrepancy, error)
+}
+
+type ReservationRepository interface {
+	GetExpiredReservationOrders(now time.Time, limit int) ([]string, error)
+	ExpireReservations(orderID string, now time.Time) (int64, error)
 }
 
 type ProductVariantRepository interface {
-	CreateProductVariant(variant *models.ProductVariant) error
+	CreateProductVariant(variant *models.ProductVariant, actor string) error
 	GetProductVariantByID(id string) (*models.ProductVariant, error)
 	GetProductVariantsByProduct(productID string) ([]models.ProductVariant, error)
 	UpdateProductVariant(id string, variant *models.ProductVariant) error
 	DeleteProductVariant(id string) error
 }
+
+type ExchangeRateRepository interface {
+	GetExchangeRate(base, quote string) (float64, error)
+	GetAllExchangeRates() ([]models.ExchangeRate, error)
+	UpsertExchangeRate(rate *models.ExchangeRate) error
+	DeleteExchangeRate(base, quote string) error
+}
@@ -0,0 +1,435 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrReservationExpired is returned when committing an order whose stock is no longer held
+var ErrReservationExpired = errors.New("stock reservation is no longer active")
+
+// ReservedItem is the catalog data of a reserved variant, the unit price is in the order currency
+type ReservedItem struct {
+	VariantID  string
+	ProductID  string
+	CategoryID string // Empty for products without category
+	UnitPrice  common.Money
+}
+
+// ReserveStock holds the quantities for the order until ttl passes and returns true, the catalog data of every
+// item and the total price of the order in the order currency if the order items are available, else false and 0.
+// On-hand stock is not changed until the reservation is committed.
+// The message id is recorded in the inbox with the reservation, a redelivered message returns common.ErrDuplicateMessage
+func (r *PostgresRepository) ReserveStock(messageID, orderID string, variantIDs []string, quantities []int, currency string, ttl time.Duration) (bool, []ReservedItem, common.Money, error) {
+	if len(variantIDs) != len(quantities) {
+		return false, nil, common.Money{}, fmt.Errorf("mismatch in variantIDs and quantities length")
+	}
+
+	var (
+		items      = make([]ReservedItem, len(variantIDs))
+		totalPrice common.Money
+	)
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := common.MarkProcessed(tx, "inventory_check_consumer", messageID); err != nil {
+			return err
+		}
+
+		// Lock the variants so concurrent reservations see each other
+		variants, err := lockVariants(tx, variantIDs)
+		if err != nil {
+			return err
+		}
+
+		expiresAt := time.Now().Add(ttl)
+		prices := r.converter(currency)
+		for i, variantID := range variantIDs {
+			variant, ok := variants[variantID]
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrVariantNotFound, variantID)
+			}
+
+			reserved, err := reservedQuantity(tx, variantID)
+			if err != nil {
+				return err
+			}
+			if variant.StockQuantity-reserved < quantities[i] {
+				return errRollback
+			}
+
+			unitPrice, err := prices.convert(variant.Price)
+			if err != nil {
+				return err
+			}
+			var product models.Product
+			if err := tx.Select("id", "category_id").Where("id = ?", variant.ProductID).First(&product).Error; err != nil {
+				return err
+			}
+			items[i] = ReservedItem{VariantID: variantID, ProductID: product.ID, UnitPrice: unitPrice}
+			if product.CategoryID != nil {
+				items[i].CategoryID = *product.CategoryID
+			}
+			if totalPrice, err = totalPrice.Add(unitPrice.Mul(int64(quantities[i]))); err != nil {
+				return err
+			}
+
+			err = tx.Create(&models.StockReservation{
+				OrderID:   orderID,
+				VariantID: variantID,
+				Quantity:  quantities[i],
+				Status:    models.ReservationActive,
+				ExpiresAt: expiresAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+			err = recordMovements(tx, models.StockMovement{
+				VariantID:     variantID,
+				Kind:          models.MovementReservation,
+				ReservedDelta: quantities[i],
+				Reason:        "held for order",
+				ReferenceID:   orderID,
+				Actor:         "inventory_check_consumer",
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errRollback) {
+		return false, nil, common.Money{}, nil //Return no error as stock is not available
+	}
+	if err != nil {
+		return false, nil, common.Money{}, err
+	}
+	return true, items, totalPrice, nil
+}
+
+// CommitReservations takes the stock held for a paid order off the on-hand stock. Holds that expired while the
+// payment was on its way are committed as well if the stock is still there.
+// Committing an order twice changes nothing, an order whose holds were released returns ErrReservationExpired
+// and one that would take a variant below zero returns ErrInsufficientStock
+func (r *PostgresRepository) CommitReservations(messageID, orderID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := common.MarkProcessed(tx, "stock_commit_consumer", messageID); err != nil {
+			return err
+		}
+
+		reservations, err := lockReservations(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := lockVariants(tx, reservationVariants(reservations)); err != nil {
+			return err
+		}
+
+		committed := 0
+		for _, reservation := range reservations {
+			switch reservation.Status {
+			case models.ReservationCommitted:
+				committed++
+			case models.ReservationActive:
+				if err := decrementStock(tx, reservation.VariantID, reservation.Quantity); err != nil {
+					return err
+				}
+				if err := setReservationStatus(tx, reservation.ID, models.ReservationCommitted); err != nil {
+					return err
+				}
+				err := recordMovements(tx, models.StockMovement{
+					VariantID:     reservation.VariantID,
+					Kind:          models.MovementOrder,
+					Delta:         -reservation.Quantity,
+					ReservedDelta: -reservation.Quantity,
+					Reason:        "order paid",
+					ReferenceID:   orderID,
+					Actor:         "stock_commit_consumer",
+				})
+				if err != nil {
+					return err
+				}
+				committed++
+			case models.ReservationExpired:
+				// The hold was already taken off the reserved stock when it expired
+				if err := decrementStock(tx, reservation.VariantID, reservation.Quantity); err != nil {
+					return err
+				}
+				if err := setReservationStatus(tx, reservation.ID, models.ReservationCommitted); err != nil {
+					return err
+				}
+				err := recordMovements(tx, models.StockMovement{
+					VariantID:   reservation.VariantID,
+					Kind:        models.MovementOrder,
+					Delta:       -reservation.Quantity,
+					Reason:      "order paid after its hold expired",
+					ReferenceID: orderID,
+					Actor:       "stock_commit_consumer",
+				})
+				if err != nil {
+					return err
+				}
+				committed++
+			}
+		}
+
+		// Orders placed before reservations existed took their stock right away
+		if len(reservations) > 0 && committed == 0 {
+			return fmt.Errorf("%w: order %s", ErrReservationExpired, orderID)
+		}
+		return nil
+	})
+}
+
+// ReleaseStock gives back the stock of a cancelled order. Active holds are released, committed ones are put back
+// on the on-hand stock. Orders placed before reservations existed get the given quantities added back.
+// A redelivered message returns common.ErrDuplicateMessage and changes nothing
+func (r *PostgresRepository) ReleaseStock(messageID, orderID string, variantIDs []string, quantities []int) error {
+	if len(variantIDs) != len(quantities) {
+		return fmt.Errorf("mismatch in variantIDs and quantities length")
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := common.MarkProcessed(tx, "stock_release_consumer", messageID); err != nil {
+			return err
+		}
+
+		reservations, err := lockReservations(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		if len(reservations) == 0 {
+			return restock(tx, variantIDs, quantities, models.StockMovement{
+				Kind:        models.MovementRestock,
+				Reason:      "order cancelled",
+				ReferenceID: orderID,
+				Actor:       "stock_release_consumer",
+			})
+		}
+
+		if _, err := lockVariants(tx, reservationVariants(reservations)); err != nil {
+			return err
+		}
+		var movements []models.StockMovement
+		for _, reservation := range reservations {
+			movement := models.StockMovement{
+				VariantID:   reservation.VariantID,
+				ReferenceID: orderID,
+				Actor:       "stock_release_consumer",
+			}
+			switch reservation.Status {
+			case models.ReservationCommitted:
+				if err := incrementStock(tx, reservation.VariantID, reservation.Quantity); err != nil {
+					return err
+				}
+				movement.Kind = models.MovementRestock
+				movement.Delta = reservation.Quantity
+				movement.Reason = "paid order cancelled"
+			case models.ReservationActive:
+				// Nothing left the on-hand stock yet, dropping the hold is enough
+				movement.Kind = models.MovementReservation
+				movement.ReservedDelta = -reservation.Quantity
+				movement.Reason = "order cancelled"
+			default:
+				continue
+			}
+			if err := setReservationStatus(tx, reservation.ID, models.ReservationReleased); err != nil {
+				return err
+			}
+			movements = append(movements, movement)
+		}
+		return recordMovements(tx, movements...)
+	})
+}
+
+// RestockItems puts refunded or returned items back on the on-hand stock. Variants that no longer exist are skipped.
+// The source names what is restocked, "return/<id>" is booked as a return.
+// A redelivered message returns common.ErrDuplicateMessage and changes nothing
+func (r *PostgresRepository) RestockItems(messageID, source string, variantIDs []string, quantities []int) error {
+	if len(variantIDs) != len(quantities) {
+		return fmt.Errorf("mismatch in variantIDs and quantities length")
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := common.MarkProcessed(tx, "stock_restock_consumer", messageID); err != nil {
+			return err
+		}
+
+		movement := models.StockMovement{
+			Kind:        models.MovementRestock,
+			Reason:      "refunded items",
+			ReferenceID: source,
+			Actor:       "stock_restock_consumer",
+		}
+		if strings.HasPrefix(source, "return/") {
+			movement.Kind = models.MovementReturn
+			movement.Reason = "returned items"
+		}
+		return restock(tx, variantIDs, quantities, movement)
+	})
+}
+
+// restock adds the quantities to the variants that exist and books a movement like the given one for each
+func restock(tx *gorm.DB, variantIDs []string, quantities []int, movement models.StockMovement) error {
+	variants, err := lockVariants(tx, variantIDs)
+	if err != nil {
+		return err
+	}
+
+	var movements []models.StockMovement
+	for i, variantID := range variantIDs {
+		if _, ok := variants[variantID]; !ok {
+			continue
+		}
+		if err := incrementStock(tx, variantID, quantities[i]); err != nil {
+			return err
+		}
+		movement.VariantID = variantID
+		movement.Delta = quantities[i]
+		movements = append(movements, movement)
+	}
+	return recordMovements(tx, movements...)
+}
+
+// GetExpiredReservationOrders returns orders holding active reservations that expired before now
+func (r *PostgresRepository) GetExpiredReservationOrders(now time.Time, limit int) ([]string, error) {
+	var orderIDs []string
+	err := r.db.Model(&models.StockReservation{}).
+		Where("status = ? AND expires_at < ?", models.ReservationActive, now).
+		Distinct("order_id").Limit(limit).Pluck("order_id", &orderIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return orderIDs, nil
+}
+
+// ExpireReservations frees the active holds of an order that expired before now and returns how many were expired
+func (r *PostgresRepository) ExpireReservations(orderID string, now time.Time) (int64, error) {
+	var expired int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var reservations []models.StockReservation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ? AND status = ? AND expires_at < ?", orderID, models.ReservationActive, now).
+			Order("variant_id").
+			Find(&reservations).Error
+		if err != nil {
+			return err
+		}
+
+		movements := make([]models.StockMovement, 0, len(reservations))
+		for _, reservation := range reservations {
+			if err := setReservationStatus(tx, reservation.ID, models.ReservationExpired); err != nil {
+				return err
+			}
+			movements = append(movements, models.StockMovement{
+				VariantID:     reservation.VariantID,
+				Kind:          models.MovementReservation,
+				ReservedDelta: -reservation.Quantity,
+				Reason:        "hold expired",
+				ReferenceID:   orderID,
+				Actor:         "reservation_sweeper",
+			})
+		}
+		expired = int64(len(reservations))
+		return recordMovements(tx, movements...)
+	})
+	return expired, err
+}
+
+// errRollback aborts a transaction without it being an error for the caller
+var errRollback = errors.New("rollback")
+
+// reservedQuantity sums the active holds on a variant
+func reservedQuantity(db *gorm.DB, variantID string) (int, error) {
+	var reserved int
+	err := db.Model(&models.StockReservation{}).
+		Where("variant_id = ? AND status = ?", variantID, models.ReservationActive).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&reserved).Error
+	return reserved, err
+}
+
+// lockVariants locks the variants and returns the ones that exist keyed by id. Every transaction that changes
+// several variants locks them here first, in id order, so two of them never wait on each other's rows.
+// The stock_update trigger writes the parent products of changed variants, so those are locked before the
+// variants, in the same product then variant order product updates take
+func lockVariants(tx *gorm.DB, variantIDs []string) (map[string]models.ProductVariant, error) {
+	ids := slices.Clone(variantIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) == 0 {
+		return map[string]models.ProductVariant{}, nil
+	}
+
+	var productIDs []string
+	err := tx.Model(&models.ProductVariant{}).Where("id IN ?", ids).Distinct().Pluck("product_id", &productIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(productIDs) > 0 {
+		var products []models.Product
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id IN ?", productIDs).Order("id").Find(&products).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Postgres takes the row locks as the sorted rows come out, not in scan order
+	var variants []models.ProductVariant
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Order("id").Find(&variants).Error
+	if err != nil {
+		return nil, err
+	}
+
+	locked := make(map[string]models.ProductVariant, len(variants))
+	for _, variant := range variants {
+		locked[variant.ID] = variant
+	}
+	return locked, nil
+}
+
+func lockReservations(tx *gorm.DB, orderID string) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ?", orderID).Order("variant_id").Find(&reservations).Error
+	return reservations, err
+}
+
+func reservationVariants(reservations []models.StockReservation) []string {
+	variantIDs := make([]string, 0, len(reservations))
+	for _, reservation := range reservations {
+		variantIDs = append(variantIDs, reservation.VariantID)
+	}
+	return variantIDs
+}
+
+func setReservationStatus(tx *gorm.DB, id string, status models.ReservationStatus) error {
+	return tx.Model(&models.StockReservation{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// decrementStock takes the quantity off the on-hand stock. The condition keeps the stock from going negative
+// even for a caller that did not check it under lock, that fails with ErrInsufficientStock.
+// Updates go through the model so the stock_update trigger keeps the product total in sync
+func decrementStock(tx *gorm.DB, variantID string, quantity int) error {
+	result := tx.Model(&models.ProductVariant{}).Where("id = ? AND stock_quantity >= ?", variantID, quantity).
+		Update("stock_quantity", gorm.Expr("stock_quantity - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: variant %s", ErrInsufficientStock, variantID)
+	}
+	return nil
+}
+
+// incrementStock updates through the model so the stock_update trigger keeps the product total in sync
+func incrementStock(tx *gorm.DB, variantID string, quantity int) error {
+	return tx.Model(&models.ProductVariant{}).Where("id = ?", variantID).
+		Update("stock_quantity", gorm.Expr("stock_quantity + ?", quantity)).Error
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL and migrates it, tests that need postgres skip without it
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("error connecting to the test database: %v", err)
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("error migrating the test database: %v", err)
+	}
+	return db
+}
+
+// seedProduct stores a product with one variant per stock level and returns the variant ids. The product, its
+// variants and their reservations are removed after the test, ledger entries are append only and stay
+func seedProduct(t *testing.T, db *gorm.DB, stocks ...int) (string, []string) {
+	t.Helper()
+	product := models.Product{
+		ID:   uuid.New().String(),
+		Name: "concurrency test",
+	}
+	product.SKU = "test-" + product.ID
+	variantIDs := make([]string, 0, len(stocks))
+	for i, stock := range stocks {
+		variantID := uuid.New().String()
+		variantIDs = append(variantIDs, variantID)
+		product.Variants = append(product.Variants, models.ProductVariant{
+			ID:            variantID,
+			SKU:           fmt.Sprintf("test-%s-%d", product.ID, i),
+			Price:         common.NewMoney(1000, "USD"),
+			StockQuantity: stock,
+		})
+	}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("error creating the product: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("variant_id IN ?", variantIDs).Delete(&models.StockReservation{})
+		db.Where("product_id = ?", product.ID).Delete(&models.ProductVariant{})
+		db.Where("id = ?", product.ID).Delete(&models.Product{})
+	})
+	return product.ID, variantIDs
+}
+
+// placeOrders reserves and commits one unit of every listed variant per order, all orders at the same time.
+// It returns how many units of each variant the orders that went through took. Postgres aborts one side of a
+// deadlock with an error, which fails the test, and a hang fails it after a timeout
+func placeOrders(t *testing.T, db *gorm.DB, repo *PostgresRepository, orders [][]string) map[string]int {
+	t.Helper()
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		messageIDs []string
+		taken      = make(map[string]int)
+		barrier    = make(chan struct{})
+		done       = make(chan struct{})
+	)
+	t.Cleanup(func() {
+		db.Where("message_id IN ?", messageIDs).Delete(&common.ProcessedMessage{})
+	})
+
+	for _, variantIDs := range orders {
+		quantities := make([]int, len(variantIDs))
+		for i := range quantities {
+			quantities[i] = 1
+		}
+		orderID := uuid.New().String()
+		reserveID, commitID := uuid.New().String(), uuid.New().String()
+		messageIDs = append(messageIDs, reserveID, commitID)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-barrier
+
+			ok, _, _, err := repo.ReserveStock(reserveID, orderID, variantIDs, quantities, "", time.Minute)
+			if err != nil {
+				t.Errorf("error reserving stock for order %s: %v", orderID, err)
+				return
+			}
+			if !ok {
+				return
+			}
+			if err := repo.CommitReservations(commitID, orderID); err != nil {
+				t.Errorf("error committing the reservation of order %s: %v", orderID, err)
+				return
+			}
+			mu.Lock()
+			for _, variantID := range variantIDs {
+				taken[variantID]++
+			}
+			mu.Unlock()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	close(barrier)
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("orders did not finish, the transactions are deadlocked")
+	}
+	return taken
+}
+
+// checkStock compares the stock left of every variant with what the orders took and the product total with its variants
+func checkStock(t *testing.T, db *gorm.DB, productID string, stocks map[string]int, taken map[string]int) {
+	t.Helper()
+	total := 0
+	for variantID, stock := range stocks {
+		var variant models.ProductVariant
+		if err := db.Where("id = ?", variantID).First(&variant).Error; err != nil {
+			t.Fatalf("error loading variant %s: %v", variantID, err)
+		}
+		if variant.StockQuantity < 0 {
+			t.Errorf("stock of variant %s went below zero: %d", variantID, variant.StockQuantity)
+		}
+		if taken[variantID] > stock {
+			t.Errorf("orders took %d units of variant %s with a stock of %d", taken[variantID], variantID, stock)
+		}
+		if variant.StockQuantity != stock-taken[variantID] {
+			t.Errorf("stock of variant %s is %d after %d of %d units were sold", variantID, variant.StockQuantity, taken[variantID], stock)
+		}
+		total += variant.StockQuantity
+	}
+
+	var product models.Product
+	if err := db.Where("id = ?", productID).First(&product).Error; err != nil {
+		t.Fatalf("error loading the product: %v", err)
+	}
+	if product.StockQuantity != total {
+		t.Errorf("product stock %d does not match the stock of its variants %d", product.StockQuantity, total)
+	}
+}
+
+// TestReserveAndCommitConcurrently has more orders than stock reserve and commit one variant at the same time.
+// No order may take stock that is not there
+func TestReserveAndCommitConcurrently(t *testing.T) {
+	db := testDB(t)
+	repo := NewPostgresRepository(db)
+
+	const stock = 5
+	productID, variantIDs := seedProduct(t, db, stock)
+	orders := make([][]string, 25)
+	for i := range orders {
+		orders[i] = []string{variantIDs[0]}
+	}
+
+	taken := placeOrders(t, db, repo, orders)
+	checkStock(t, db, productID, map[string]int{variantIDs[0]: stock}, taken)
+}
+
+// TestReserveInOppositeOrder has half the orders ask for [A, B] and half for [B, A]. Locking the rows in the
+// order the items were listed deadlocks these, the variants have to be locked in id order
+func TestReserveInOppositeOrder(t *testing.T) {
+	db := testDB(t)
+	repo := NewPostgresRepository(db)
+
+	const stock = 10
+	productID, variantIDs := seedProduct(t, db, stock, stock)
+	a, b := variantIDs[0], variantIDs[1]
+	orders := make([][]string, 40)
+	for i := range orders {
+		if i%2 == 0 {
+			orders[i] = []string{a, b}
+		} else {
+			orders[i] = []string{b, a}
+		}
+	}
+
+	taken := placeOrders(t, db, repo, orders)
+	if taken[a] != taken[b] {
+		t.Errorf("orders took %d of A and %d of B, every order asks for both", taken[a], taken[b])
+	}
+	checkStock(t, db, productID, map[string]int{a: stock, b: stock}, taken)
+}
+
+// TestReserveRepeatedVariant lists a variant twice within one order, in both orders against a second variant.
+// Both holds count against the stock and the variant is only locked once
+func TestReserveRepeatedVariant(t *testing.T) {
+	db := testDB(t)
+	repo := NewPostgresRepository(db)
+
+	const stock = 7
+	productID, variantIDs := seedProduct(t, db, stock, stock)
+	a, b := variantIDs[0], variantIDs[1]
+	orders := make([][]string, 20)
+	for i := range orders {
+		if i%2 == 0 {
+			orders[i] = []string{a, b, a}
+		} else {
+			orders[i] = []string{b, a, b}
+		}
+	}
+
+	taken := placeOrders(t, db, repo, orders)
+	checkStock(t, db, productID, map[string]int{a: stock, b: stock}, taken)
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/inventory_service/internals/domain/models"
+	"gorm.io/gorm"
+)
+
+// MovementQuery selects ledger entries, empty fields do not filter
+type MovementQuery struct {
+	VariantID string
+	Kind      models.MovementKind
+	From      time.Time // Inclusive
+	To        time.Time // Exclusive
+	Page      int       // 1 based
+	PageSize  int
+}
+
+// GetStockMovements returns a page of the matching movements, newest first, and how many match in total
+func (r *PostgresRepository) GetStockMovements(query MovementQuery) ([]models.StockMovement, int64, error) {
+	db := r.db.Model(&models.StockMovement{})
+	if query.VariantID != "" {
+		db = db.Where("variant_id = ?", query.VariantID)
+	}
+	if query.Kind != "" {
+		db = db.Where("kind = ?", query.Kind)
+	}
+	if !query.From.IsZero() {
+		db = db.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("created_at < ?", query.To)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var movements []models.StockMovement
+	err := db.Order("created_at DESC, id").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&movements).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return movements, total, nil
+}
+
+// AdjustStock changes the on-hand stock of a variant by hand and records why. Stock cannot be taken below
+// what active reservations hold, that fails with ErrInsufficientStock
+func (r *PostgresRepository) AdjustStock(variantID string, delta int, reason, actor string) (*models.StockMovement, error) {
+	movement := models.StockMovement{
+		VariantID:   variantID,
+		Kind:        models.MovementAdjustment,
+		Delta:       delta,
+		Reason:      reason,
+		ReferenceID: variantID,
+		Actor:       actor,
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		variants, err := lockVariants(tx, []string{variantID})
+		if err != nil {
+			return err
+		}
+		variant, ok := variants[variantID]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrVariantNotFound, variantID)
+		}
+
+		if delta < 0 {
+			reserved, err := reservedQuantity(tx, variantID)
+			if err != nil {
+				return err
+			}
+			if variant.StockQuantity+delta < reserved {
+				return fmt.Errorf("%w, available: %d", ErrInsufficientStock, variant.StockQuantity-reserved)
+			}
+			if err := decrementStock(tx, variantID, -delta); err != nil {
+				return err
+			}
+		} else if err := incrementStock(tx, variantID, delta); err != nil {
+			return err
+		}
+		return recordMovements(tx, movement)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &movement, nil
+}
+
+// ReconcileStock recomputes the stock of the variant, or of every variant when the id is empty, from the ledger
+// and returns the variants whose on-hand stock or reservations do not match it
+func (r *PostgresRepository) ReconcileStock(variantID string) ([]models.StockDiscrepancy, error) {
+	// One statement, so stock, reservations and ledger are read from the same snapshot
+	query := `
+		SELECT v.id AS variant_id,
+			COALESCE(v.stock_quantity, 0) AS stock_quantity,
+			COALESCE(m.stock, 0) AS ledger_stock,
+			COALESCE(res.reserved, 0) AS reserved,
+			COALESCE(m.reserved, 0) AS ledger_reserved
+		FROM product_variants v
+		LEFT JOIN (
+			SELECT variant_id, SUM(delta) AS stock, SUM(reserved_delta) AS reserved
+			FROM stock_movements GROUP BY variant_id
+		) m ON m.variant_id = v.id
+		LEFT JOIN (
+			SELECT variant_id, SUM(quantity) AS reserved
+			FROM stock_reservations WHERE status = @active GROUP BY variant_id
+		) res ON res.variant_id = v.id
+		WHERE (COALESCE(v.stock_quantity, 0) <> COALESCE(m.stock, 0) OR COALESCE(res.reserved, 0) <> COALESCE(m.reserved, 0))
+			AND (@variant = '' OR v.id::text = @variant)
+		ORDER BY v.id`
+
+	var discrepancies []models.StockDiscrepancy
+	err := r.db.Raw(query, map[string]interface{}{
+		"active":  models.ReservationActive,
+		"variant": variantID,
+	}).Scan(&discrepancies).Error
+	if err != nil {
+		return nil, err
+	}
+	return discrepancies, nil
+}
+
+func recordMovements(tx *gorm.DB, movements ...models.StockMovement) error {
+	if len(movements) == 0 {
+		return nil
+	}
+	return tx.Create(&movements).Error
+}
@@ -0,0 +1,190 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+var (
+	ErrVariantNotFound      = errors.New("variant not found")
+	ErrInsufficientStock    = errors.New("insufficient stock")
+	ErrCurrencyNotSupported = errors.New("currency not supported")
+)
+
+// StockLevel is what inventory reports for a variant, the price is in the requested currency
+type StockLevel struct {
+	StockLevel int           `json:"stock_level"`
+	Price      *common.Money `json:"price"`
+}
+
+// StockQuery is a variant and the quantity wanted of it
+type StockQuery struct {
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Codes inventory reports per item of a batch check
+const (
+	stockOK                   = "ok"
+	stockNotFound             = "not_found"
+	stockInsufficient         = "insufficient_stock"
+	stockCurrencyNotSupported = "currency_not_supported"
+)
+
+// ItemAvailability is what inventory reports for one item of a batch check. Err is ErrVariantNotFound,
+// ErrCurrencyNotSupported or ErrInsufficientStock when the item cannot be ordered
+type ItemAvailability struct {
+	VariantID  string        `json:"variant_id"`
+	Quantity   int           `json:"quantity"`
+	StockLevel int           `json:"stock_level"`
+	Available  bool          `json:"available"`
+	Price      *common.Money `json:"price"`
+	Code       string        `json:"code"`
+	Error      string        `json:"error"`
+	Err        error         `json:"-"`
+}
+
+// InventoryClient asks the inventory service for the stock and catalog price of product variants
+type InventoryClient interface {
+	// CheckStockLevel fails with ErrInsufficientStock and the available stock when there is not enough of the variant
+	CheckStockLevel(token, variantID string, quantity int, currency string) (*StockLevel, error)
+	// CheckStockLevels returns the availability of the items in the order they were asked for
+	CheckStockLevels(token string, items []StockQuery, currency string) ([]ItemAvailability, error)
+}
+
+// maxStockQueries is the most items inventory checks in one call
+const maxStockQueries = 100
+
+type HTTPInventoryClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPInventoryClient(baseURL string) *HTTPInventoryClient {
+	return &HTTPInventoryClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// CheckStockLevel calls POST /api/products/v1/checkstock/:id, the token of the caller is forwarded as cookie
+func (c *HTTPInventoryClient) CheckStockLevel(token, variantID string, quantity int, currency string) (*StockLevel, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"quantity": quantity,
+		"currency": currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/api/products/v1/checkstock/"+variantID, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var level StockLevel
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&level); err != nil {
+			return nil, err
+		}
+		if level.Price == nil {
+			return nil, fmt.Errorf("inventory returned no price for variant %s", variantID)
+		}
+		return &level, nil
+	case http.StatusConflict:
+		if err := json.NewDecoder(resp.Body).Decode(&level); err != nil {
+			return nil, err
+		}
+		return &level, fmt.Errorf("%w, available: %d", ErrInsufficientStock, level.StockLevel)
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrVariantNotFound, variantID)
+	case http.StatusUnprocessableEntity:
+		return nil, fmt.Errorf("%w: %s", ErrCurrencyNotSupported, currency)
+	default:
+		return nil, fmt.Errorf("inventory check stock failed with status %d", resp.StatusCode)
+	}
+}
+
+// CheckStockLevels calls POST /api/products/v1/checkstock with at most maxStockQueries items per call
+func (c *HTTPInventoryClient) CheckStockLevels(token string, items []StockQuery, currency string) ([]ItemAvailability, error) {
+	availability := make([]ItemAvailability, 0, len(items))
+	for start := 0; start < len(items); start += maxStockQueries {
+		batch, err := c.checkStockBatch(token, items[start:min(start+maxStockQueries, len(items))], currency)
+		if err != nil {
+			return nil, err
+		}
+		availability = append(availability, batch...)
+	}
+	return availability, nil
+}
+
+func (c *HTTPInventoryClient) checkStockBatch(token string, items []StockQuery, currency string) ([]ItemAvailability, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"items":    items,
+		"currency": currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/api/products/v1/checkstock", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("inventory check stock failed with status %d", resp.StatusCode)
+	}
+	var result struct {
+		Items []ItemAvailability `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Items) != len(items) {
+		return nil, fmt.Errorf("inventory reported %d of %d items", len(result.Items), len(items))
+	}
+
+	for i := range result.Items {
+		item := &result.Items[i]
+		switch item.Code {
+		case stockNotFound:
+			item.Err = fmt.Errorf("%w: %s", ErrVariantNotFound, item.VariantID)
+		case stockCurrencyNotSupported:
+			item.Err = fmt.Errorf("%w: %s", ErrCurrencyNotSupported, currency)
+		case stockInsufficient:
+			item.Err = fmt.Errorf("%w, available: %d", ErrInsufficientStock, item.StockLevel)
+		case stockOK:
+			if item.Price == nil {
+				item.Err = fmt.Errorf("inventory returned no price for variant %s", item.VariantID)
+			}
+		default:
+			item.Err = fmt.Errorf("inventory reported unknown code %q for variant %s: %s", item.Code, item.VariantID, item.Error)
+		}
+	}
+	return result.Items, nil
+}
@@ -0,0 +1,108 @@
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	common "github.com/palashbhasme/ecommerce_microservices/common/models"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// Address is a saved address of a user as the user service returns it
+type Address struct {
+	ID        string `json:"id"`
+	Line1     string `json:"line1"`
+	Line2     string `json:"line2"`
+	City      string `json:"city"`
+	State     string `json:"state"`
+	Country   string `json:"country"`
+	ZipCode   string `json:"zip_code"`
+	IsDefault bool   `json:"is_default"`
+}
+
+// User is a user profile as the user service returns it
+type User struct {
+	ID        string    `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Addresses []Address `json:"addresses"`
+}
+
+// UserClient looks up user profiles in the user service
+type UserClient interface {
+	GetUser(token, userID string) (*User, error)
+	GetAddresses(token, userID string) ([]Address, error)
+}
+
+type HTTPUserClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPUserClient(baseURL string) *HTTPUserClient {
+	return &HTTPUserClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (c *HTTPUserClient) GetAddresses(token, userID string) ([]Address, error) {
+	user, err := c.GetUser(token, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.Addresses, nil
+}
+
+// GetUser calls GET /api/users/v1/:id, the token is forwarded as cookie
+func (c *HTTPUserClient) GetUser(token, userID string) (*User, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+"/api/users/v1/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var body struct {
+			User User `json:"user"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return nil, err
+		}
+		return &body.User, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	default:
+		return nil, fmt.Errorf("user lookup failed with status %d", resp.StatusCode)
+	}
+}
+
+// ServiceToken signs a short lived token for calls the service makes on its own behalf, such as from
+// message consumers where no user token is at hand
+func ServiceToken(jwtSecret string) (string, error) {
+	claims := common.Claims{
+		Role:   "service",
+		UserID: "order_service",
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "order_service",
+			ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(jwtSecret))
+}
@@ -0,0 +1,56 @@
+package mapper
+
+import (
+	"github.com/palashbhasme/order_service/internals/api/dto/request"
+	"github.com/palashbhasme/order_service/internals/api/dto/response"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+// ToCartResponse converts a cart, problems are keyed by variant id
+func ToCartResponse(cart *models.Cart, problems map[string]string) (response.CartResponse, error) {
+	subtotal, err := cart.Subtotal()
+	if err != nil {
+		return response.CartResponse{}, err
+	}
+
+	items := make([]response.CartItemResponse, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		items = append(items, response.CartItemResponse{
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			LineTotal: item.UnitPrice.Mul(int64(item.Quantity)),
+			Problem:   problems[item.VariantID],
+		})
+	}
+
+	return response.CartResponse{
+		ID:            cart.ID,
+		UserID:        cart.UserID,
+		Currency:      cart.Currency,
+		TotalQuantity: cart.TotalQuantity(),
+		Subtotal:      subtotal,
+		UpdatedAt:     cart.UpdatedAt,
+		Items:         items,
+	}, nil
+}
+
+// CartToOrderRequest turns the cart into the request the create order flow takes, cart prices become the quotes
+func CartToOrderRequest(cart *models.Cart) request.OrderRequest {
+	orderItems := make([]request.OrderItemReq, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		price := item.UnitPrice
+		orderItems = append(orderItems, request.OrderItemReq{
+			ProductID: item.VariantID,
+			Price:     &price,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	return request.OrderRequest{
+		UserID:     cart.UserID,
+		OrderItems: orderItems,
+		Quantity:   cart.TotalQuantity(),
+		Currency:   cart.Currency,
+	}
+}
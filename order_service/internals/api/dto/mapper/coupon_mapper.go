@@ -0,0 +1,75 @@
+package mapper
+
+import (
+	"strings"
+
+	"github.com/palashbhasme/order_service/internals/api/dto/request"
+	"github.com/palashbhasme/order_service/internals/api/dto/response"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+func ToCouponModel(req request.CouponRequest) *models.Coupon {
+	coupon := &models.Coupon{
+		Code:           strings.ToUpper(strings.TrimSpace(req.Code)),
+		Type:           models.CouponType(req.Type),
+		PercentOff:     req.PercentOff,
+		AmountOff:      req.AmountOff,
+		MinOrderValue:  req.MinOrderValue,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		Active:         true,
+	}
+
+	for _, productID := range req.ProductIDs {
+		coupon.Restrictions = append(coupon.Restrictions, models.CouponRestriction{Kind: models.RestrictProduct, RefID: productID})
+	}
+	for _, categoryID := range req.CategoryIDs {
+		coupon.Restrictions = append(coupon.Restrictions, models.CouponRestriction{Kind: models.RestrictCategory, RefID: categoryID})
+	}
+
+	return coupon
+}
+
+func ToCouponResponse(coupon *models.Coupon) response.CouponResponse {
+	couponResponse := response.CouponResponse{
+		ID:             coupon.ID,
+		Code:           coupon.Code,
+		Type:           coupon.Type,
+		PercentOff:     coupon.PercentOff,
+		AmountOff:      coupon.AmountOff,
+		MinOrderValue:  coupon.MinOrderValue,
+		StartsAt:       coupon.StartsAt,
+		EndsAt:         coupon.EndsAt,
+		MaxUses:        coupon.MaxUses,
+		MaxUsesPerUser: coupon.MaxUsesPerUser,
+		Active:         coupon.Active,
+		ProductIDs:     []string{},
+		CategoryIDs:    []string{},
+		CreatedBy:      coupon.CreatedBy,
+		CreatedAt:      coupon.CreatedAt,
+		UpdatedAt:      coupon.UpdatedAt,
+	}
+
+	for _, restriction := range coupon.Restrictions {
+		switch restriction.Kind {
+		case models.RestrictProduct:
+			couponResponse.ProductIDs = append(couponResponse.ProductIDs, restriction.RefID)
+		case models.RestrictCategory:
+			couponResponse.CategoryIDs = append(couponResponse.CategoryIDs, restriction.RefID)
+		}
+	}
+
+	return couponResponse
+}
+
+func ToCouponResponses(coupons []models.Coupon) []response.CouponResponse {
+	couponResponses := make([]response.CouponResponse, 0, len(coupons))
+
+	for _, coupon := range coupons {
+		couponResponses = append(couponResponses, ToCouponResponse(&coupon))
+	}
+
+	return couponResponses
+}
@@ -0,0 +1,42 @@
+package mapper
+
+import (
+	"github.com/palashbhasme/order_service/internals/api/dto/response"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+func ToInvoiceResponse(invoice *models.Invoice) response.InvoiceResponse {
+	lines := make([]response.InvoiceLineResponse, 0, len(invoice.Lines))
+	for _, line := range invoice.Lines {
+		lines = append(lines, response.InvoiceLineResponse{
+			Position:       line.Position,
+			ProductID:      line.ProductID,
+			Quantity:       line.Quantity,
+			UnitPrice:      line.UnitPrice,
+			Discount:       line.Discount,
+			TaxBasisPoints: line.TaxBasisPoints,
+			Tax:            line.Tax,
+			Total:          line.Total,
+		})
+	}
+
+	return response.InvoiceResponse{
+		Number:   invoice.Number,
+		OrderID:  invoice.OrderID,
+		IssuedAt: invoice.IssuedAt,
+		Currency: invoice.Currency,
+		Buyer: response.BuyerResponse{
+			UserID: invoice.BuyerID,
+			Name:   invoice.BuyerName,
+			Email:  invoice.BuyerEmail,
+			Phone:  invoice.BuyerPhone,
+		},
+		ShippingAddress: ToShippingAddressResponse(invoice.ShippingAddress),
+		CouponCode:      invoice.CouponCode,
+		Lines:           lines,
+		Subtotal:        invoice.Subtotal,
+		DiscountTotal:   invoice.DiscountTotal,
+		TaxTotal:        invoice.TaxTotal,
+		Total:           invoice.Total,
+	}
+}
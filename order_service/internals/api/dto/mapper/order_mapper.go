@@ -1,6 +1,11 @@
 package mapper
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/api/clients"
 	"github.com/palashbhasme/order_service/internals/api/dto/request"
 	"github.com/palashbhasme/order_service/internals/api/dto/response"
 	"github.com/palashbhasme/order_service/internals/domain/models"
@@ -12,32 +17,96 @@ func ToOrderModel(req request.OrderRequest) *models.Order {
 		UserID:   req.UserID,
 		Quantity: req.Quantity,
 		Status:   models.OrderPending, // Default status
+		Currency: common.DefaultCurrency,
+	}
+	if req.Currency != "" {
+		order.Currency = strings.ToUpper(req.Currency)
 	}
+	order.CouponCode = strings.ToUpper(strings.TrimSpace(req.CouponCode))
 
 	// Preallocate slice memory for better performance
 	order.OrderItems = make([]models.OrderItem, len(req.OrderItems))
 
 	for i, item := range req.OrderItems {
-		order.OrderItems[i] = ToItemModel(item)
+		order.OrderItems[i] = ToItemModel(item, order.Currency)
 	}
 
+	// Amounts are stored with their currency, they are all zero in the order currency until the order is priced
+	order.TotalAmount = common.Zero(order.Currency)
+	order.Subtotal = common.Zero(order.Currency)
+	order.DiscountTotal = common.Zero(order.Currency)
+	order.TaxTotal = common.Zero(order.Currency)
+
 	return order
 }
 
-func ToItemModel(item request.OrderItemReq) models.OrderItem {
-	return models.OrderItem{
-		ProductID: item.ProductID,
-		Price:     item.Price,
-		Quantity:  item.Quantity,
+func ToItemModel(item request.OrderItemReq, currency string) models.OrderItem {
+	orderItem := models.OrderItem{
+		ProductID:   item.ProductID,
+		Price:       common.Zero(currency),
+		QuotedPrice: item.Price,
+		Quantity:    item.Quantity,
+		Discount:    common.Zero(currency),
+		Tax:         common.Zero(currency),
+	}
+	// Price stays the quote until inventory confirms the order with catalog prices
+	if item.Price != nil {
+		orderItem.Price = *item.Price
+	}
+	return orderItem
+}
+
+// ToItemRequests converts stored order items back to the shape used in inventory messages
+func ToItemRequests(items []models.OrderItem) []request.OrderItemReq {
+	itemRequests := make([]request.OrderItemReq, 0, len(items))
+
+	for _, item := range items {
+		itemRequests = append(itemRequests, request.OrderItemReq{
+			ProductID: item.ProductID,
+			Price:     item.QuotedPrice,
+			Quantity:  item.Quantity,
+		})
 	}
+
+	return itemRequests
 }
 
 func ToItemResponse(item models.OrderItem) response.OrderItemResponse {
 	return response.OrderItemResponse{
-		ID:        item.ID,
-		ProductID: item.ProductID,
-		Price:     item.Price,
-		Quantity:  item.Quantity,
+		ID:             item.ID,
+		ProductID:      item.ProductID,
+		Price:          item.Price,
+		QuotedPrice:    item.QuotedPrice,
+		Quantity:       item.Quantity,
+		Discount:       item.Discount,
+		Tax:            item.Tax,
+		TaxBasisPoints: item.TaxBasisPoints,
+	}
+}
+
+// ToShippingAddress copies a saved user address into the snapshot stored on an order, the country code
+// is stored upper case as tax rates are looked up by it
+func ToShippingAddress(address clients.Address) models.ShippingAddress {
+	return models.ShippingAddress{
+		AddressID: address.ID,
+		Line1:     address.Line1,
+		Line2:     address.Line2,
+		City:      address.City,
+		State:     address.State,
+		Country:   strings.ToUpper(strings.TrimSpace(address.Country)),
+		ZipCode:   address.ZipCode,
+	}
+}
+
+func ToShippingAddressResponse(address models.ShippingAddress) response.ShippingAddressResponse {
+	return response.ShippingAddressResponse{
+		AddressID: address.AddressID,
+		Line1:     address.Line1,
+		Line2:     address.Line2,
+		City:      address.City,
+		State:     address.State,
+		Country:   address.Country,
+		ZipCode:   address.ZipCode,
 	}
 }
 
@@ -50,13 +119,23 @@ func ToOrderResponse(order *models.Order) response.OrderResponse {
 	}
 
 	return response.OrderResponse{
-		OrderID:    order.OrderID,
-		UserID:     order.UserID,
-		Quantity:   order.Quantity,
-		Status:     order.Status,
-		CreatedAt:  order.CreatedAt,
-		UpdatedAt:  order.UpdatedAt,
-		OrderItems: orderItems,
+		OrderID:         order.OrderID,
+		UserID:          order.UserID,
+		Quantity:        order.Quantity,
+		Status:          order.Status,
+		Currency:        order.Currency,
+		TotalAmount:     order.TotalAmount,
+		Subtotal:        order.Subtotal,
+		DiscountTotal:   order.DiscountTotal,
+		TaxTotal:        order.TaxTotal,
+		CouponCode:      order.CouponCode,
+		PriceMismatch:   order.PriceMismatch,
+		ShippingAddress: ToShippingAddressResponse(order.ShippingAddress),
+		CreatedAt:       order.CreatedAt,
+		UpdatedAt:       order.UpdatedAt,
+		OrderItems:      orderItems,
+		Refunds:         ToRefundResponses(order.Refunds),
+		Returns:         ToReturnResponses(order.Returns),
 	}
 }
 
@@ -69,3 +148,265 @@ func ToOrderResponses(orders []models.Order) []response.OrderResponse {
 
 	return orderResponses
 }
+
+// defaultPageSize is used for listings that do not ask for a page size
+const defaultPageSize = 20
+
+// ToOrderQuery converts the listing parameters, unknown statuses are refused
+func ToOrderQuery(req request.ListOrdersRequest) (models.OrderQuery, error) {
+	query := models.OrderQuery{
+		UserID:    req.UserID,
+		From:      req.From,
+		To:        req.To,
+		ProductID: req.ProductID,
+		SortBy:    req.Sort,
+		Ascending: req.Order == "asc",
+		Page:      req.Page,
+		PageSize:  req.PageSize,
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	for _, param := range req.Status {
+		for _, value := range strings.Split(param, ",") {
+			// An empty ?status= or a trailing comma does not filter
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			status := models.OrderStatus(value)
+			if !status.IsValid() {
+				return models.OrderQuery{}, fmt.Errorf("unknown order status %q", value)
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	}
+	return query, nil
+}
+
+func ToPageResponse(query models.OrderQuery, total int64) response.PageResponse {
+	pageSize := int64(query.PageSize)
+	return response.PageResponse{
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+		Total:      total,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	}
+}
+
+func ToStatusEventResponses(events []models.OrderStatusEvent) []response.OrderStatusEventResponse {
+	eventResponses := make([]response.OrderStatusEventResponse, 0, len(events))
+
+	for _, event := range events {
+		eventResponses = append(eventResponses, response.OrderStatusEventResponse{
+			FromStatus: event.FromStatus,
+			ToStatus:   event.ToStatus,
+			Actor:      event.Actor,
+			Reason:     event.Reason,
+			MessageID:  event.MessageID,
+			CreatedAt:  event.CreatedAt,
+		})
+	}
+
+	return eventResponses
+}
+
+func ToPaymentAttemptResponses(attempts []models.PaymentAttempt) []response.PaymentAttemptResponse {
+	attemptResponses := make([]response.PaymentAttemptResponse, 0, len(attempts))
+
+	for _, attempt := range attempts {
+		attemptResponses = append(attemptResponses, response.PaymentAttemptResponse{
+			ID:            attempt.ID,
+			Amount:        attempt.Amount,
+			Provider:      attempt.Provider,
+			ProviderRef:   attempt.ProviderRef,
+			Status:        attempt.Status,
+			FailureReason: attempt.FailureReason,
+			CreatedAt:     attempt.CreatedAt,
+		})
+	}
+
+	return attemptResponses
+}
+
+// RefundItemsToRequests converts refunded items to the shape used in inventory messages
+func RefundItemsToRequests(items []models.RefundItem) []request.OrderItemReq {
+	itemRequests := make([]request.OrderItemReq, 0, len(items))
+
+	for _, item := range items {
+		itemRequests = append(itemRequests, request.OrderItemReq{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	return itemRequests
+}
+
+func ToRefundResponses(refunds []models.Refund) []response.RefundResponse {
+	refundResponses := make([]response.RefundResponse, 0, len(refunds))
+
+	for _, refund := range refunds {
+		refundResponses = append(refundResponses, ToRefundResponse(&refund))
+	}
+
+	return refundResponses
+}
+
+func ToRefundResponse(refund *models.Refund) response.RefundResponse {
+	items := make([]response.RefundItemResponse, 0, len(refund.Items))
+	for _, item := range refund.Items {
+		items = append(items, response.RefundItemResponse{
+			OrderItemID: item.OrderItemID,
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+			Amount:      item.Amount,
+		})
+	}
+
+	return response.RefundResponse{
+		ID:            refund.ID,
+		Amount:        refund.Amount,
+		Reason:        refund.Reason,
+		Status:        refund.Status,
+		Restock:       refund.Restock,
+		RequestedBy:   refund.RequestedBy,
+		ProviderRef:   refund.ProviderRef,
+		FailureReason: refund.FailureReason,
+		CreatedAt:     refund.CreatedAt,
+		UpdatedAt:     refund.UpdatedAt,
+		Items:         items,
+	}
+}
+
+// ToRefundLines converts the refund request items, no items means a full refund
+func ToRefundLines(items []request.RefundItemReq) []models.RefundLine {
+	lines := make([]models.RefundLine, 0, len(items))
+
+	for _, item := range items {
+		lines = append(lines, models.RefundLine{
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	return lines
+}
+
+func ToReturnResponses(returns []models.ReturnRequest) []response.ReturnResponse {
+	returnResponses := make([]response.ReturnResponse, 0, len(returns))
+
+	for _, ret := range returns {
+		returnResponses = append(returnResponses, ToReturnResponse(&ret))
+	}
+
+	return returnResponses
+}
+
+func ToReturnResponse(ret *models.ReturnRequest) response.ReturnResponse {
+	items := make([]response.ReturnItemResponse, 0, len(ret.Items))
+	for _, item := range ret.Items {
+		items = append(items, response.ReturnItemResponse{
+			OrderItemID: item.OrderItemID,
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+			Reason:      item.Reason,
+			Restockable: item.Restockable,
+		})
+	}
+
+	return response.ReturnResponse{
+		ID:             ret.ID,
+		Status:         ret.Status,
+		RequestedBy:    ret.RequestedBy,
+		ReviewedBy:     ret.ReviewedBy,
+		ResolutionNote: ret.ResolutionNote,
+		ReceivedAt:     ret.ReceivedAt,
+		CreatedAt:      ret.CreatedAt,
+		UpdatedAt:      ret.UpdatedAt,
+		Items:          items,
+	}
+}
+
+func ToReturnLines(items []request.ReturnItemReq) []models.ReturnLine {
+	lines := make([]models.ReturnLine, 0, len(items))
+
+	for _, item := range items {
+		lines = append(lines, models.ReturnLine{
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+			Reason:      item.Reason,
+		})
+	}
+
+	return lines
+}
+
+// ReturnItemsToRequests converts the restockable returned items to the shape used in inventory messages
+func ReturnItemsToRequests(items []models.ReturnItem) []request.OrderItemReq {
+	itemRequests := make([]request.OrderItemReq, 0, len(items))
+
+	for _, item := range items {
+		if !item.Restockable {
+			continue
+		}
+		itemRequests = append(itemRequests, request.OrderItemReq{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	return itemRequests
+}
+
+func ToTrackingResponse(order *models.Order) response.TrackingResponse {
+	shipments := make([]response.ShipmentResponse, 0, len(order.Shipments))
+
+	for _, shipment := range order.Shipments {
+		shipments = append(shipments, ToShipmentResponse(&shipment))
+	}
+
+	return response.TrackingResponse{
+		OrderID:   order.OrderID,
+		Status:    order.Status,
+		Shipments: shipments,
+	}
+}
+
+func ToShipmentResponse(shipment *models.Shipment) response.ShipmentResponse {
+	items := make([]response.ShipmentItemResponse, 0, len(shipment.Items))
+	for _, item := range shipment.Items {
+		items = append(items, response.ShipmentItemResponse{
+			OrderItemID: item.OrderItemID,
+			ProductID:   item.ProductID,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	return response.ShipmentResponse{
+		ID:             shipment.ID,
+		Carrier:        shipment.Carrier,
+		TrackingNumber: shipment.TrackingNumber,
+		Status:         shipment.Status,
+		ShippedAt:      shipment.ShippedAt,
+		DeliveredAt:    shipment.DeliveredAt,
+		Items:          items,
+	}
+}
+
+func ToShipmentLines(items []request.ShipmentItemReq) []models.ShipmentLine {
+	lines := make([]models.ShipmentLine, 0, len(items))
+
+	for _, item := range items {
+		lines = append(lines, models.ShipmentLine{
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	return lines
+}
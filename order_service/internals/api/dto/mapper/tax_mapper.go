@@ -0,0 +1,39 @@
+package mapper
+
+import (
+	"strings"
+
+	"github.com/palashbhasme/order_service/internals/api/dto/request"
+	"github.com/palashbhasme/order_service/internals/api/dto/response"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+func ToTaxRateModel(req request.TaxRateRequest) *models.TaxRate {
+	return &models.TaxRate{
+		Country:     strings.ToUpper(req.Country),
+		State:       req.State,
+		CategoryID:  req.CategoryID,
+		BasisPoints: req.BasisPoints,
+	}
+}
+
+func ToTaxRateResponse(rate *models.TaxRate) response.TaxRateResponse {
+	return response.TaxRateResponse{
+		ID:          rate.ID,
+		Country:     rate.Country,
+		State:       rate.State,
+		CategoryID:  rate.CategoryID,
+		BasisPoints: rate.BasisPoints,
+		UpdatedAt:   rate.UpdatedAt,
+	}
+}
+
+func ToTaxRateResponses(rates []models.TaxRate) []response.TaxRateResponse {
+	rateResponses := make([]response.TaxRateResponse, 0, len(rates))
+
+	for _, rate := range rates {
+		rateResponses = append(rateResponses, ToTaxRateResponse(&rate))
+	}
+
+	return rateResponses
+}
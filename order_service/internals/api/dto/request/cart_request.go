@@ -0,0 +1,20 @@
+package request
+
+type CartItemRequest struct {
+	VariantID string `json:"variant_id" binding:"required,uuid"` // Inventory product variant id
+	Quantity  int    `json:"quantity" binding:"required,gt=0"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,gt=0"`
+}
+
+type CartCurrencyRequest struct {
+	Currency string `json:"currency" binding:"required,len=3"` // ISO 4217 code, items are repriced in it
+}
+
+// CheckoutRequest is the optional body of a checkout
+type CheckoutRequest struct {
+	AddressID  string `json:"address_id"` // Saved user address to ship to, defaults to the default address
+	CouponCode string `json:"coupon_code"`
+}
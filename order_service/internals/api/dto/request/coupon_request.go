@@ -0,0 +1,22 @@
+package request
+
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+// CouponRequest defines a coupon, restrictions reference inventory product and category ids
+type CouponRequest struct {
+	Code           string        `json:"code" binding:"required,max=64"`
+	Type           string        `json:"type" binding:"required,oneof=percentage fixed_amount"`
+	PercentOff     int           `json:"percent_off" binding:"omitempty,min=1,max=100"` // Percentage coupons
+	AmountOff      *common.Money `json:"amount_off,omitempty" binding:"omitempty,gt=0"` // Fixed amount coupons
+	MinOrderValue  *common.Money `json:"min_order_value,omitempty" binding:"omitempty,gt=0"`
+	StartsAt       *time.Time    `json:"starts_at,omitempty"`
+	EndsAt         *time.Time    `json:"ends_at,omitempty"`
+	MaxUses        int           `json:"max_uses" binding:"omitempty,min=0"` // 0 is unlimited
+	MaxUsesPerUser int           `json:"max_uses_per_user" binding:"omitempty,min=0"`
+	ProductIDs     []string      `json:"product_ids" binding:"omitempty,dive,uuid"`
+	CategoryIDs    []string      `json:"category_ids" binding:"omitempty,dive,uuid"`
+}
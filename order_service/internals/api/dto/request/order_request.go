@@ -1,14 +1,91 @@
 package request
 
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
 type OrderRequest struct {
-	UserID     string         `json:"user_id" binding:"required"`          // Must be a valid UUID
+	UserID     string         `json:"user_id"`                             // Taken from the token, admins may order for another user
 	OrderItems []OrderItemReq `json:"order_items" binding:"required,dive"` // Validate each OrderItemReq
 	Quantity   int            `json:"quantity" binding:"required,gt=0"`    // Must be greater than 0
+	Currency   string         `json:"currency" binding:"omitempty,len=3"`  // ISO 4217 code, defaults to USD
+	AddressID  string         `json:"address_id"`                          // Saved user address to ship to, defaults to the default address
+	CouponCode string         `json:"coupon_code"`                         // Optional, the discount is applied with the catalog prices
 }
 
 // OrderItemReq represents individual order items.
 type OrderItemReq struct {
-	ProductID string  `json:"product_id" binding:"required,uuid"` // Must be a valid UUID
-	Price     float64 `json:"price" binding:"required,gt=0"`      // Must be greater than 0
-	Quantity  int     `json:"quantity" binding:"required,gt=0"`   // Must be greater than 0
+	ProductID string        `json:"product_id" binding:"required,uuid"`       // Must be a valid UUID
+	Price     *common.Money `json:"price,omitempty" binding:"omitempty,gt=0"` // Optional quote, the catalog price is authoritative
+	Quantity  int           `json:"quantity" binding:"required,gt=0"`         // Must be greater than 0
+}
+
+// ListOrdersRequest holds the query parameters of an order listing, all of them are optional
+type ListOrdersRequest struct {
+	Status    []string  `form:"status"`                                                                            // Repeated or comma separated
+	From      time.Time `form:"from"`                                                                              // RFC 3339, created at or after
+	To        time.Time `form:"to"`                                                                                // RFC 3339, created before
+	UserID    string    `form:"user_id"`                                                                           // Ignored on /user/:id
+	ProductID string    `form:"product_id" binding:"omitempty,uuid"`                                               // Orders containing the product variant
+	Sort      string    `form:"sort" binding:"omitempty,oneof=created_at updated_at status quantity total_amount"` // Defaults to created_at
+	Order     string    `form:"order" binding:"omitempty,oneof=asc desc"`                                          // Defaults to desc
+	Page      int       `form:"page" binding:"omitempty,min=1"`
+	PageSize  int       `form:"page_size" binding:"omitempty,min=1,max=100"` // Defaults to 20
+}
+
+// CancelOrderRequest is the optional body of a cancellation
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RefundRequest asks for a full refund, or a partial one when items are given
+type RefundRequest struct {
+	Reason  string          `json:"reason" binding:"required"`
+	Items   []RefundItemReq `json:"items" binding:"omitempty,dive"`
+	Restock bool            `json:"restock"` // Put the refunded items back on stock
+}
+
+type RefundItemReq struct {
+	OrderItemID string `json:"order_item_id" binding:"required,uuid"`
+	Quantity    int    `json:"quantity" binding:"required,gt=0"`
+}
+
+// ReturnRequest opens a return for some of the delivered items
+type ReturnRequest struct {
+	Items []ReturnItemReq `json:"items" binding:"required,min=1,dive"`
+}
+
+type ReturnItemReq struct {
+	OrderItemID string `json:"order_item_id" binding:"required,uuid"`
+	Quantity    int    `json:"quantity" binding:"required,gt=0"`
+	Reason      string `json:"reason" binding:"required"`
+}
+
+// ReviewReturnRequest is the optional body when approving or rejecting a return
+type ReviewReturnRequest struct {
+	Note string `json:"note"`
+}
+
+// ReceiveReturnRequest is the optional body when a return arrived, items not listed are restocked
+type ReceiveReturnRequest struct {
+	Items []ReturnItemCondition `json:"items" binding:"omitempty,dive"`
+}
+
+type ReturnItemCondition struct {
+	OrderItemID string `json:"order_item_id" binding:"required,uuid"`
+	Restockable bool   `json:"restockable"`
+}
+
+// ShipmentRequest hands items of a paid order to a carrier, without items everything left to ship is sent
+type ShipmentRequest struct {
+	Carrier        string            `json:"carrier" binding:"required"`
+	TrackingNumber string            `json:"tracking_number" binding:"required"`
+	Items          []ShipmentItemReq `json:"items" binding:"omitempty,dive"`
+}
+
+type ShipmentItemReq struct {
+	OrderItemID string `json:"order_item_id" binding:"required,uuid"`
+	Quantity    int    `json:"quantity" binding:"required,gt=0"`
 }
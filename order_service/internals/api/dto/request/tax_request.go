@@ -0,0 +1,9 @@
+package request
+
+// TaxRateRequest sets the rate for a country, narrowed to a state and an inventory category when given
+type TaxRateRequest struct {
+	Country     string `json:"country" binding:"required,len=2"` // ISO 3166-1 alpha-2
+	State       string `json:"state" binding:"max=64"`
+	CategoryID  string `json:"category_id" binding:"omitempty,uuid"`
+	BasisPoints int    `json:"basis_points" binding:"min=0,max=10000"` // 825 is 8.25%
+}
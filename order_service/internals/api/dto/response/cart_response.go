@@ -0,0 +1,26 @@
+package response
+
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+// CartResponse represents the cart of the logged in user with prices checked against inventory
+type CartResponse struct {
+	ID            string             `json:"id"`
+	UserID        string             `json:"user_id"`
+	Currency      string             `json:"currency"`
+	TotalQuantity int                `json:"total_quantity"`
+	Subtotal      common.Money       `json:"subtotal"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+	Items         []CartItemResponse `json:"items"`
+}
+
+type CartItemResponse struct {
+	VariantID string       `json:"variant_id"`
+	Quantity  int          `json:"quantity"`
+	UnitPrice common.Money `json:"unit_price"`
+	LineTotal common.Money `json:"line_total"`
+	Problem   string       `json:"problem,omitempty"` // Why the item cannot be checked out, e.g. insufficient stock
+}
@@ -0,0 +1,27 @@
+package response
+
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+type CouponResponse struct {
+	ID             string            `json:"id"`
+	Code           string            `json:"code"`
+	Type           models.CouponType `json:"type"`
+	PercentOff     int               `json:"percent_off,omitempty"`
+	AmountOff      *common.Money     `json:"amount_off,omitempty"`
+	MinOrderValue  *common.Money     `json:"min_order_value,omitempty"`
+	StartsAt       *time.Time        `json:"starts_at,omitempty"`
+	EndsAt         *time.Time        `json:"ends_at,omitempty"`
+	MaxUses        int               `json:"max_uses"`
+	MaxUsesPerUser int               `json:"max_uses_per_user"`
+	Active         bool              `json:"active"`
+	ProductIDs     []string          `json:"product_ids"`
+	CategoryIDs    []string          `json:"category_ids"`
+	CreatedBy      string            `json:"created_by"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,41 @@
+package response
+
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+type InvoiceResponse struct {
+	Number          string                  `json:"number"`
+	OrderID         string                  `json:"order_id"`
+	IssuedAt        time.Time               `json:"issued_at"`
+	Currency        string                  `json:"currency"`
+	Buyer           BuyerResponse           `json:"buyer"`
+	ShippingAddress ShippingAddressResponse `json:"shipping_address"`
+	CouponCode      string                  `json:"coupon_code,omitempty"`
+	Lines           []InvoiceLineResponse   `json:"lines"`
+	Subtotal        common.Money            `json:"subtotal"`
+	DiscountTotal   common.Money            `json:"discount_total"`
+	TaxTotal        common.Money            `json:"tax_total"`
+	Total           common.Money            `json:"total"`
+}
+
+// BuyerResponse is who the invoice is made out to
+type BuyerResponse struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Phone  string `json:"phone,omitempty"`
+}
+
+type InvoiceLineResponse struct {
+	Position       int          `json:"position"`
+	ProductID      string       `json:"product_id"`
+	Quantity       int          `json:"quantity"`
+	UnitPrice      common.Money `json:"unit_price"`
+	Discount       common.Money `json:"discount"`
+	TaxBasisPoints int          `json:"tax_basis_points"`
+	Tax            common.Money `json:"tax"`
+	Total          common.Money `json:"total"`
+}
@@ -3,24 +3,145 @@ package response
 import (
 	"time"
 
+	"github.com/palashbhasme/ecommerce_microservices/common"
 	"github.com/palashbhasme/order_service/internals/domain/models"
 )
 
 // OrderResponse represents the structure of the order data sent to the user
 type OrderResponse struct {
-	OrderID    string              `json:"order_id"`
-	UserID     string              `json:"user_id"`
-	Quantity   int                 `json:"quantity"`
-	Status     models.OrderStatus  `json:"status"`
-	CreatedAt  time.Time           `json:"created_at"`
-	UpdatedAt  time.Time           `json:"updated_at"`
-	OrderItems []OrderItemResponse `json:"order_items"`
+	OrderID         string                  `json:"order_id"`
+	UserID          string                  `json:"user_id"`
+	Quantity        int                     `json:"quantity"`
+	Status          models.OrderStatus      `json:"status"`
+	Currency        string                  `json:"currency"`
+	TotalAmount     common.Money            `json:"total_amount"`
+	Subtotal        common.Money            `json:"subtotal"`
+	DiscountTotal   common.Money            `json:"discount_total"`
+	TaxTotal        common.Money            `json:"tax_total"`
+	CouponCode      string                  `json:"coupon_code,omitempty"`
+	PriceMismatch   bool                    `json:"price_mismatch"`
+	ShippingAddress ShippingAddressResponse `json:"shipping_address"`
+	CreatedAt       time.Time               `json:"created_at"`
+	UpdatedAt       time.Time               `json:"updated_at"`
+	OrderItems      []OrderItemResponse     `json:"order_items"`
+	Refunds         []RefundResponse        `json:"refunds"`
+	Returns         []ReturnResponse        `json:"returns"`
+}
+
+// ShippingAddressResponse is the address snapshot the order ships to
+type ShippingAddressResponse struct {
+	AddressID string `json:"address_id"`
+	Line1     string `json:"line1"`
+	Line2     string `json:"line2,omitempty"`
+	City      string `json:"city"`
+	State     string `json:"state"`
+	Country   string `json:"country"`
+	ZipCode   string `json:"zip_code"`
+}
+
+// PageResponse describes the page of a listing
+type PageResponse struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"page_size"`
+	Total      int64 `json:"total"`
+	TotalPages int64 `json:"total_pages"`
 }
 
 // OrderItemResponse represents the structure of an order item in the order response
 type OrderItemResponse struct {
-	ID        string  `json:"id"`
-	ProductID string  `json:"product_id"`
-	Price     float64 `json:"price"`
-	Quantity  int     `json:"quantity"`
+	ID             string        `json:"id"`
+	ProductID      string        `json:"product_id"`
+	Price          common.Money  `json:"price"`
+	QuotedPrice    *common.Money `json:"quoted_price,omitempty"`
+	Quantity       int           `json:"quantity"`
+	Discount       common.Money  `json:"discount"` // Off the whole line
+	Tax            common.Money  `json:"tax"`      // On the discounted line
+	TaxBasisPoints int           `json:"tax_basis_points"`
+}
+
+// OrderStatusEventResponse represents one entry of the order status history
+type OrderStatusEventResponse struct {
+	FromStatus models.OrderStatus `json:"from_status"`
+	ToStatus   models.OrderStatus `json:"to_status"`
+	Actor      string             `json:"actor"`
+	Reason     string             `json:"reason,omitempty"`
+	MessageID  string             `json:"message_id,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+// PaymentAttemptResponse represents one charge of an order at the payment gateway
+type PaymentAttemptResponse struct {
+	ID            string               `json:"id"`
+	Amount        common.Money         `json:"amount"`
+	Provider      string               `json:"provider"`
+	ProviderRef   string               `json:"provider_ref"`
+	Status        models.PaymentStatus `json:"status"`
+	FailureReason string               `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+}
+
+// RefundResponse represents a full or partial refund of an order
+type RefundResponse struct {
+	ID            string               `json:"id"`
+	Amount        common.Money         `json:"amount"`
+	Reason        string               `json:"reason"`
+	Status        models.RefundStatus  `json:"status"`
+	Restock       bool                 `json:"restock"`
+	RequestedBy   string               `json:"requested_by"`
+	ProviderRef   string               `json:"provider_ref,omitempty"`
+	FailureReason string               `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+	Items         []RefundItemResponse `json:"items,omitempty"`
+}
+
+type RefundItemResponse struct {
+	OrderItemID string       `json:"order_item_id"`
+	ProductID   string       `json:"product_id"`
+	Quantity    int          `json:"quantity"`
+	Amount      common.Money `json:"amount"`
+}
+
+// ReturnResponse represents a return request of an order
+type ReturnResponse struct {
+	ID             string               `json:"id"`
+	Status         models.ReturnStatus  `json:"status"`
+	RequestedBy    string               `json:"requested_by"`
+	ReviewedBy     string               `json:"reviewed_by,omitempty"`
+	ResolutionNote string               `json:"resolution_note,omitempty"`
+	ReceivedAt     *time.Time           `json:"received_at,omitempty"`
+	CreatedAt      time.Time            `json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+	Items          []ReturnItemResponse `json:"items"`
+}
+
+type ReturnItemResponse struct {
+	OrderItemID string `json:"order_item_id"`
+	ProductID   string `json:"product_id"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+	Restockable bool   `json:"restockable"`
+}
+
+// TrackingResponse is the customer view of where the items of an order are
+type TrackingResponse struct {
+	OrderID   string             `json:"order_id"`
+	Status    models.OrderStatus `json:"status"`
+	Shipments []ShipmentResponse `json:"shipments"`
+}
+
+type ShipmentResponse struct {
+	ID             string                 `json:"id"`
+	Carrier        string                 `json:"carrier"`
+	TrackingNumber string                 `json:"tracking_number"`
+	Status         models.ShipmentStatus  `json:"status"`
+	ShippedAt      time.Time              `json:"shipped_at"`
+	DeliveredAt    *time.Time             `json:"delivered_at,omitempty"`
+	Items          []ShipmentItemResponse `json:"items"`
+}
+
+type ShipmentItemResponse struct {
+	OrderItemID string `json:"order_item_id"`
+	ProductID   string `json:"product_id"`
+	Quantity    int    `json:"quantity"`
 }
@@ -0,0 +1,12 @@
+package response
+
+import "time"
+
+type TaxRateResponse struct {
+	ID          string    `json:"id"`
+	Country     string    `json:"country"`
+	State       string    `json:"state,omitempty"`
+	CategoryID  string    `json:"category_id,omitempty"`
+	BasisPoints int       `json:"basis_points"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palashbhasme/ecommerce_microservices/common/middlewares"
+	common "github.com/palashbhasme/ecommerce_microservices/common/models"
+	"github.com/palashbhasme/order_service/internals/api/clients"
+	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/order_service/internals/api/dto/request"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type CartHandler struct {
+	repo      repository.CartRepository
+	inventory clients.InventoryClient
+	users     clients.UserClient
+	logger    *zap.Logger
+}
+
+func InitializeCartHandler(router *gin.Engine, repo repository.CartRepository, inventory clients.InventoryClient, users clients.UserClient, logger *zap.Logger) {
+	cartHandler := CartHandler{
+		repo:      repo,
+		inventory: inventory,
+		users:     users,
+		logger:    logger,
+	}
+	authconfig := common.NewAuthConfig(os.Getenv("JWT_SECRET"))
+
+	api := router.Group("/api")
+	{
+		cartRoutes := api.Group("/cart/v1")
+		cartRoutes.Use(middlewares.AuthMiddleware(*authconfig))
+		{
+			cartRoutes.GET("/", cartHandler.GetCart)
+			cartRoutes.PUT("/", cartHandler.SetCurrency)
+			cartRoutes.POST("/items", cartHandler.AddItem)
+			cartRoutes.PUT("/items/:variant_id", cartHandler.UpdateItem)
+			cartRoutes.DELETE("/items/:variant_id", cartHandler.RemoveItem)
+			cartRoutes.POST("/checkout", cartHandler.Checkout)
+		}
+	}
+}
+
+// returns the cart of the logged in user with prices and stock checked against inventory
+func (h *CartHandler) GetCart(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	cart, err := h.repo.GetCart(userID)
+	if err != nil {
+		h.logger.Error("error failed to fetch cart", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch cart"})
+		return
+	}
+
+	problems, err := h.revalidate(c, cart)
+	if err != nil {
+		h.logger.Error("error revalidating cart", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to check cart against inventory"})
+		return
+	}
+
+	h.respond(c, http.StatusOK, cart, problems)
+}
+
+// changes the currency the cart is priced in
+func (h *CartHandler) SetCurrency(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var currencyRequest request.CartCurrencyRequest
+	if err := c.ShouldBindJSON(&currencyRequest); err != nil {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	if err := h.repo.SetCartCurrency(userID, strings.ToUpper(currencyRequest.Currency)); err != nil {
+		h.logger.Error("error setting cart currency", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to update cart"})
+		return
+	}
+
+	h.GetCart(c)
+}
+
+// adds a product variant to the cart, adding a variant that is already in the cart replaces its quantity
+func (h *CartHandler) AddItem(c *gin.Context) {
+	var itemRequest request.CartItemRequest
+	if err := c.ShouldBindJSON(&itemRequest); err != nil {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	h.saveItem(c, itemRequest.VariantID, itemRequest.Quantity)
+}
+
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	var itemRequest request.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&itemRequest); err != nil {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	h.saveItem(c, c.Param("variant_id"), itemRequest.Quantity)
+}
+
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := h.repo.RemoveCartItem(userID, c.Param("variant_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "item not in cart"})
+			return
+		}
+		h.logger.Error("error removing cart item", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to remove cart item"})
+		return
+	}
+
+	h.GetCart(c)
+}
+
+// turns the cart into an order through the same flow as POST /api/orders/v1/ and empties the cart.
+// Every item is checked against inventory first, the current catalog prices become the order quotes
+func (h *CartHandler) Checkout(c *gin.Context) {
+	userID, ok := userID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var checkoutRequest request.CheckoutRequest
+	if err := c.ShouldBindJSON(&checkoutRequest); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	cart, err := h.repo.GetCart(userID)
+	if err != nil {
+		h.logger.Error("error failed to fetch cart", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch cart"})
+		return
+	}
+	if len(cart.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cart is empty"})
+		return
+	}
+
+	problems, err := h.revalidate(c, cart)
+	if err != nil {
+		h.logger.Error("error revalidating cart", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to check cart against inventory"})
+		return
+	}
+	if len(problems) > 0 {
+		h.respond(c, http.StatusConflict, cart, problems)
+		return
+	}
+
+	address, ok := resolveAddress(c, h.users, h.logger, userID, checkoutRequest.AddressID)
+	if !ok {
+		return
+	}
+
+	orderRequest := mapper.CartToOrderRequest(cart)
+	orderRequest.CouponCode = checkoutRequest.CouponCode
+
+	order, inventoryCheck, err := newOrder(orderRequest, address)
+	if err != nil {
+		h.logger.Error("error building inventory check", zap.Error(err))
+		c.JSON(500, gin.H{"message": "internal server error"})
+		return
+	}
+
+	orderID, err := h.repo.CheckoutCart(userID, cart.Items, order, inventoryCheck)
+	if err != nil {
+		if errors.Is(err, repository.ErrCartEmpty) || errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cart is empty"})
+			return
+		}
+		if errors.Is(err, repository.ErrCartChanged) {
+			c.JSON(http.StatusConflict, gin.H{"error": "cart was changed during checkout, please review it and retry"})
+			return
+		}
+		if couponError(c, err) {
+			return
+		}
+		h.logger.Error("error checking out cart", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to check out cart"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Order request received, processing...",
+		"order_id": orderID,
+		"status":   models.OrderPending,
+	})
+}
+
+// saveItem checks stock and price of the variant in inventory and stores it in the cart of the user
+func (h *CartHandler) saveItem(c *gin.Context, variantID string, quantity int) {
+	userID, ok := userID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	cart, err := h.repo.GetCart(userID)
+	if err != nil {
+		h.logger.Error("error failed to fetch cart", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch cart"})
+		return
+	}
+
+	token, _ := c.Cookie("token")
+	level, err := h.inventory.CheckStockLevel(token, variantID, quantity, cart.Currency)
+	switch {
+	case errors.Is(err, clients.ErrVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "product variant not found"})
+		return
+	case errors.Is(err, clients.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "insufficient stock", "stock_level": level.StockLevel})
+		return
+	case errors.Is(err, clients.ErrCurrencyNotSupported):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "cart currency not supported for this product"})
+		return
+	case err != nil:
+		h.logger.Error("error checking stock level", zap.Error(err), zap.String("variant_id", variantID))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to check stock level"})
+		return
+	}
+
+	item := models.CartItem{
+		VariantID: variantID,
+		Quantity:  quantity,
+		UnitPrice: *level.Price,
+	}
+	if err := h.repo.SaveCartItem(userID, &item); err != nil {
+		h.logger.Error("error saving cart item", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to save cart item"})
+		return
+	}
+
+	h.GetCart(c)
+}
+
+// revalidate refreshes the cart prices from inventory and returns the items that cannot be ordered, keyed by
+// variant id. Changed prices are stored so the cart shows what checkout will quote
+func (h *CartHandler) revalidate(c *gin.Context, cart *models.Cart) (map[string]string, error) {
+	token, _ := c.Cookie("token")
+	problems := make(map[string]string)
+	if len(cart.Items) == 0 {
+		return problems, nil
+	}
+
+	queries := make([]clients.StockQuery, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		queries = append(queries, clients.StockQuery{VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+	availability, err := h.inventory.CheckStockLevels(token, queries, cart.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		level := availability[i]
+		switch {
+		case errors.Is(level.Err, clients.ErrVariantNotFound):
+			problems[item.VariantID] = "product variant no longer exists"
+			continue
+		case errors.Is(level.Err, clients.ErrInsufficientStock):
+			problems[item.VariantID] = fmt.Sprintf("insufficient stock, available: %d", level.StockLevel)
+			continue
+		case errors.Is(level.Err, clients.ErrCurrencyNotSupported):
+			problems[item.VariantID] = "cart currency not supported for this product"
+			continue
+		case level.Err != nil:
+			return nil, level.Err
+		}
+
+		if item.UnitPrice.Equal(*level.Price) {
+			continue
+		}
+		item.UnitPrice = *level.Price
+		if err := h.repo.UpdateCartItemPrice(item.ID, item.UnitPrice); err != nil {
+			return nil, err
+		}
+	}
+
+	return problems, nil
+}
+
+func (h *CartHandler) respond(c *gin.Context, status int, cart *models.Cart, problems map[string]string) {
+	cartResponse, err := mapper.ToCartResponse(cart, problems)
+	if err != nil {
+		h.logger.Error("error building cart response", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch cart"})
+		return
+	}
+	c.JSON(status, gin.H{"cart": cartResponse})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palashbhasme/ecommerce_microservices/common/middlewares"
+	common "github.com/palashbhasme/ecommerce_microservices/common/models"
+	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/order_service/internals/api/dto/request"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"go.uber.org/zap"
+)
+
+type CouponHandler struct {
+	repo   repository.CouponRepository
+	logger *zap.Logger
+}
+
+func InitializeCouponHandler(router *gin.Engine, repo repository.CouponRepository, logger *zap.Logger) {
+	couponHandler := CouponHandler{
+		repo:   repo,
+		logger: logger,
+	}
+	authconfig := common.NewAuthConfig(os.Getenv("JWT_SECRET"))
+
+	api := router.Group("/api")
+	{
+		couponRoutes := api.Group("/coupons/v1")
+		couponRoutes.Use(middlewares.AuthMiddleware(*authconfig), middlewares.AdminMiddleware())
+		{
+			couponRoutes.POST("/", couponHandler.CreateCoupon)
+			couponRoutes.GET("/", couponHandler.GetCoupons)
+			couponRoutes.GET("/:code", couponHandler.GetCoupon)
+			couponRoutes.DELETE("/:code", couponHandler.DeactivateCoupon)
+		}
+	}
+}
+
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+	var couponRequest request.CouponRequest
+	if err := c.ShouldBindJSON(&couponRequest); err != nil {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	coupon := mapper.ToCouponModel(couponRequest)
+	coupon.CreatedBy = actor(c)
+	if err := coupon.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.repo.CreateCoupon(coupon)
+	if err != nil {
+		if errors.Is(err, repository.ErrCouponExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("error creating coupon", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to create coupon"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"coupon": mapper.ToCouponResponse(coupon)})
+}
+
+func (h *CouponHandler) GetCoupons(c *gin.Context) {
+	coupons, err := h.repo.GetCoupons()
+	if err != nil {
+		h.logger.Error("error failed to fetch coupons", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch coupons"})
+		return
+	}
+
+	c.JSON(200, gin.H{"coupons": mapper.ToCouponResponses(coupons)})
+}
+
+// returns the coupon with the number of orders that currently use it
+func (h *CouponHandler) GetCoupon(c *gin.Context) {
+	coupon, err := h.repo.GetCoupon(strings.ToUpper(c.Param("code")))
+	if err != nil {
+		if errors.Is(err, repository.ErrCouponNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+			return
+		}
+		h.logger.Error("error failed to fetch coupon", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch coupon"})
+		return
+	}
+
+	redemptions, _, err := h.repo.CountRedemptions(coupon.ID, "")
+	if err != nil {
+		h.logger.Error("error counting coupon redemptions", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch coupon"})
+		return
+	}
+
+	c.JSON(200, gin.H{"coupon": mapper.ToCouponResponse(coupon), "redemptions": redemptions})
+}
+
+// stops a coupon from being used by new orders, orders that already used it keep their discount
+func (h *CouponHandler) DeactivateCoupon(c *gin.Context) {
+	code := strings.ToUpper(c.Param("code"))
+
+	err := h.repo.SetCouponActive(code, false)
+	if err != nil {
+		if errors.Is(err, repository.ErrCouponNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+			return
+		}
+		h.logger.Error("error deactivating coupon", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to deactivate coupon"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Coupon deactivated", "code": code})
+}
+
+// couponError writes the response for coupon errors of order creation and reports whether err was one
+func couponError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrCouponNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+	case errors.Is(err, models.ErrCouponNotApplicable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palashbhasme/order_service/internals/notify"
+	"go.uber.org/zap"
+)
+
+// heartbeatInterval keeps idle event streams from being closed by proxies
+const heartbeatInterval = 15 * time.Second
+
+// streams the status changes of an order as server-sent events. The current status is sent first,
+// the stream ends when the order reaches a final status or the client goes away
+func (h *OrderHandler) StreamOrderEvents(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Streaming order events", zap.String("id", id))
+
+	// Subscribe before loading the order so no change between the two is missed
+	events, unsubscribe := h.hub.Subscribe(id)
+	defer unsubscribe()
+
+	order, ok := h.fetchOrder(c, id)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.SSEvent("status", notify.StatusEvent{
+		OrderID:  order.OrderID,
+		ToStatus: order.Status,
+		At:       order.UpdatedAt,
+	})
+	if order.Status.IsFinal() {
+		c.Writer.Flush()
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, open := <-events:
+			if !open {
+				// Dropped for falling behind, the client reconnects and gets the current status
+				return false
+			}
+			c.SSEvent("status", event)
+			return !event.ToStatus.IsFinal()
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
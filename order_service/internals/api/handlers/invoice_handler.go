@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palashbhasme/order_service/internals/api/clients"
+	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/invoice"
+	"go.uber.org/zap"
+)
+
+// returns the invoice of a confirmed order as JSON, or as PDF with ?format=pdf or an Accept header asking for it.
+// Invoices are issued when the order is confirmed, one that is still missing is issued here
+func (h *OrderHandler) GetOrderInvoice(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Fetching order invoice", zap.String("id", id))
+
+	order, ok := h.fetchOrder(c, id)
+	if !ok {
+		return
+	}
+
+	token, _ := c.Cookie("token")
+	inv, err := h.invoices.Issue(token, order)
+	switch {
+	case errors.Is(err, models.ErrInvoiceNotAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, clients.ErrUserNotFound):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "buyer of the order not found"})
+		return
+	case err != nil:
+		h.logger.Error("error issuing invoice", zap.String("id", id), zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch invoice"})
+		return
+	}
+
+	if wantsPDF(c) {
+		c.Header("Content-Disposition", `attachment; filename="`+inv.Number+`.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", invoice.RenderPDF(inv))
+		return
+	}
+
+	c.JSON(200, gin.H{"invoice": mapper.ToInvoiceResponse(inv)})
+}
+
+func wantsPDF(c *gin.Context) bool {
+	if format := c.Query("format"); format != "" {
+		return strings.EqualFold(format, "pdf")
+	}
+	return strings.Contains(c.GetHeader("Accept"), "application/pdf")
+}
@@ -1,33 +1,50 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/palashbhasme/ecommerce_microservices/common/middlewares"
-	"github.com/palashbhasme/ecommerce_microservices/common/models"
+	common "github.com/palashbhasme/ecommerce_microservices/common/models"
+	"github.com/palashbhasme/order_service/internals/api/clients"
 	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
 	"github.com/palashbhasme/order_service/internals/api/dto/request"
 	"github.com/palashbhasme/order_service/internals/api/rabbitmq"
+	"github.com/palashbhasme/order_service/internals/domain/models"
 	"github.com/palashbhasme/order_service/internals/domain/repository"
-	"github.com/rabbitmq/amqp091-go"
+	"github.com/palashbhasme/order_service/internals/invoice"
+	"github.com/palashbhasme/order_service/internals/notify"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type OrderHandler struct {
-	repo       repository.OrdersRepository
-	logger     *zap.Logger
-	connRabbit *amqp091.Connection
+	repo           repository.OrdersRepository
+	users          clients.UserClient
+	invoices       *invoice.Issuer
+	hub            *notify.Hub   // Status changes made here are published to it, order event streams read from it
+	idempotencyTTL time.Duration // How long an Idempotency-Key replays its response
+	logger         *zap.Logger
 }
 
-func InitializeOrderHandler(router *gin.Engine, repo repository.OrdersRepository, logger *zap.Logger, config rabbitmq.RabbitMQConn) {
+func InitializeOrderHandler(router *gin.Engine, repo repository.OrdersRepository, users clients.UserClient, invoices *invoice.Issuer, hub *notify.Hub, idempotencyTTL time.Duration, logger *zap.Logger) {
 	orderHandler := OrderHandler{
-		repo:       repo,
-		logger:     logger,
-		connRabbit: config.Conn,
+		repo:           repo,
+		users:          users,
+		invoices:       invoices,
+		hub:            hub,
+		idempotencyTTL: idempotencyTTL,
+		logger:         logger,
 	}
-	authconfig := models.NewAuthConfig(os.Getenv("JWT_SECRET"))
+	authconfig := common.NewAuthConfig(os.Getenv("JWT_SECRET"))
 
 	api := router.Group("/api")
 	{
@@ -37,12 +54,33 @@ func InitializeOrderHandler(router *gin.Engine, repo repository.OrdersRepository
 			orderRoutes.POST("/", orderHandler.CreateOrder)
 			orderRoutes.GET("/:id", orderHandler.GetOrderByID)
 			orderRoutes.GET("/user/:id", orderHandler.GetUserOrders)
+			orderRoutes.POST("/:id/cancel", orderHandler.CancelOrder)
+			orderRoutes.GET("/:id/history", orderHandler.GetOrderHistory)
+			orderRoutes.GET("/:id/payments", orderHandler.GetOrderPayments)
+			orderRoutes.POST("/:id/returns", orderHandler.CreateReturn)
+			orderRoutes.GET("/:id/returns", orderHandler.GetOrderReturns)
+			orderRoutes.GET("/:id/tracking", orderHandler.GetOrderTracking)
+			orderRoutes.GET("/:id/events", orderHandler.StreamOrderEvents)
+			orderRoutes.GET("/:id/invoice", orderHandler.GetOrderInvoice)
+
+			adminRoutes := orderRoutes.Group("/")
+			adminRoutes.Use(middlewares.AdminMiddleware())
+			{
+				adminRoutes.GET("/", orderHandler.ListOrders)
+				adminRoutes.POST("/:id/refunds", orderHandler.CreateRefund)
+				adminRoutes.POST("/:id/returns/:return_id/approve", orderHandler.ApproveReturn)
+				adminRoutes.POST("/:id/returns/:return_id/reject", orderHandler.RejectReturn)
+				adminRoutes.POST("/:id/returns/:return_id/receive", orderHandler.ReceiveReturn)
+				adminRoutes.POST("/:id/shipments", orderHandler.CreateShipment)
+				adminRoutes.POST("/:id/shipments/:shipment_id/deliver", orderHandler.DeliverShipment)
+			}
 		}
 
 	}
 }
 
-// creates an order and publishes and inventory check event on rabbitmq inventory_check exchange
+// creates an order and queues an inventory check event for the rabbitmq inventory_check exchange.
+// A request with an Idempotency-Key header that was already used by the user gets the original response
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	var orderRequest request.OrderRequest
 	err := c.ShouldBindJSON(&orderRequest)
@@ -52,25 +90,190 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
-	order := mapper.ToOrderModel(orderRequest)
-	orderID, err := h.repo.CreateOrder(order)
+	// Orders belong to the logged in user, only admins may order on behalf of someone else
+	callerID, _ := userID(c)
+	switch {
+	case orderRequest.UserID == "" || orderRequest.UserID == callerID:
+		orderRequest.UserID = callerID
+	case !isAdmin(c):
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	if orderRequest.UserID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if len(idempotencyKey) > 255 {
+		c.JSON(400, gin.H{"message": "Idempotency-Key must be at most 255 characters"})
+		return
+	}
+	requestHash, err := hashRequest(orderRequest)
 	if err != nil {
-		h.logger.Error("error creating order", zap.Error(err))
-		c.JSON(400, gin.H{"message": "invalid request body"})
+		h.logger.Error("error hashing request", zap.Error(err))
+		c.JSON(500, gin.H{"message": "internal server error"})
 		return
 	}
 
-	err = rabbitmq.PublishInventoryCheck(orderID, orderRequest.OrderItems, h.logger, h.connRabbit)
+	// Retries are answered before doing any work, the key is claimed for good when the order is stored
+	if idempotencyKey != "" {
+		stored, err := h.repo.GetIdempotencyKey(orderRequest.UserID, idempotencyKey)
+		switch {
+		case err == nil:
+			h.replay(c, stored, requestHash)
+			return
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			h.logger.Error("error fetching idempotency key", zap.Error(err))
+			c.JSON(500, gin.H{"message": "internal server error"})
+			return
+		}
+	}
+
+	address, ok := resolveAddress(c, h.users, h.logger, orderRequest.UserID, orderRequest.AddressID)
+	if !ok {
+		return
+	}
+
+	order, inventoryCheck, err := newOrder(orderRequest, address)
+	if errors.Is(err, errQuoteCurrency) {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
 	if err != nil {
-		h.logger.Error("error publishing order", zap.Error(err))
+		h.logger.Error("error building inventory check", zap.Error(err))
 		c.JSON(500, gin.H{"message": "internal server error"})
 		return
 	}
-	c.JSON(http.StatusAccepted, gin.H{
+
+	response := gin.H{
 		"message":  "Order request received, processing...",
-		"order_id": orderID,
-		"status":   "pending",
-	})
+		"order_id": order.OrderID,
+		"status":   models.OrderPending,
+	}
+
+	if idempotencyKey == "" {
+		if _, err := h.repo.CreateOrder(order, inventoryCheck); err != nil {
+			if couponError(c, err) {
+				return
+			}
+			h.logger.Error("error creating order", zap.Error(err))
+			c.JSON(500, gin.H{"message": "internal server error"})
+			return
+		}
+		c.JSON(http.StatusAccepted, response)
+		return
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("error encoding response", zap.Error(err))
+		c.JSON(500, gin.H{"message": "internal server error"})
+		return
+	}
+	key := &models.IdempotencyKey{
+		UserID:      orderRequest.UserID,
+		Key:         idempotencyKey,
+		RequestHash: requestHash,
+		OrderID:     order.OrderID,
+		StatusCode:  http.StatusAccepted,
+		Response:    body,
+		ExpiresAt:   time.Now().Add(h.idempotencyTTL),
+	}
+	stored, err := h.repo.CreateOrderIdempotent(key, order, inventoryCheck)
+	switch {
+	case errors.Is(err, models.ErrIdempotencyKeyReused):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case couponError(c, err):
+	case err != nil:
+		h.logger.Error("error creating order", zap.Error(err))
+		c.JSON(500, gin.H{"message": "internal server error"})
+	case stored != nil:
+		// A concurrent request with the same key won the race
+		h.replay(c, stored, requestHash)
+	default:
+		c.Data(http.StatusAccepted, "application/json; charset=utf-8", body)
+	}
+}
+
+// replay answers a retried request with the stored response of its idempotency key
+func (h *OrderHandler) replay(c *gin.Context, stored *models.IdempotencyKey, requestHash string) {
+	if !stored.Matches(requestHash) {
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrIdempotencyKeyReused.Error()})
+		return
+	}
+	h.logger.Info("replaying idempotent order request", zap.String("order_id", stored.OrderID), zap.String("key", stored.Key))
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(stored.StatusCode, "application/json; charset=utf-8", stored.Response)
+}
+
+// hashRequest fingerprints the decoded request, so formatting differences of the same body do not count as a change
+func hashRequest(orderRequest request.OrderRequest) (string, error) {
+	body, err := json.Marshal(orderRequest)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// errQuoteCurrency is returned by newOrder for item prices in another currency than the order
+var errQuoteCurrency = errors.New("item prices must be in the order currency")
+
+// newOrder builds a pending order shipping to the address and the inventory check event that has to be stored with it
+func newOrder(orderRequest request.OrderRequest, address models.ShippingAddress) (*models.Order, models.OutboxMessage, error) {
+	order := mapper.ToOrderModel(orderRequest)
+	order.OrderID = uuid.New().String()
+	order.ShippingAddress = address
+
+	// Quotes are compared with catalog prices in the order currency
+	for _, item := range order.OrderItems {
+		if item.QuotedPrice != nil && item.QuotedPrice.Currency != order.Currency {
+			return nil, models.OutboxMessage{}, errQuoteCurrency
+		}
+	}
+
+	// The inventory check is stored with the order and published by the outbox relay
+	inventoryCheck, err := rabbitmq.NewInventoryCheck(order.OrderID, order.Currency, orderRequest.OrderItems)
+	if err != nil {
+		return nil, models.OutboxMessage{}, err
+	}
+	return order, inventoryCheck, nil
+}
+
+// resolveAddress looks up the saved address of the user an order ships to, the default address when no id is given.
+// It writes the error response and returns false when there is no address to ship to
+func resolveAddress(c *gin.Context, users clients.UserClient, logger *zap.Logger, userID, addressID string) (models.ShippingAddress, bool) {
+	token, _ := c.Cookie("token")
+	addresses, err := users.GetAddresses(token, userID)
+	if err != nil {
+		if errors.Is(err, clients.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return models.ShippingAddress{}, false
+		}
+		logger.Error("error fetching user addresses", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to fetch shipping address"})
+		return models.ShippingAddress{}, false
+	}
+
+	for _, address := range addresses {
+		if (addressID != "" && address.ID == addressID) || (addressID == "" && address.IsDefault) {
+			shipping := mapper.ToShippingAddress(address)
+			// Tax rates are keyed by ISO 3166-1 alpha-2 codes, an address without one cannot be taxed
+			if !models.IsCountryCode(shipping.Country) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "shipping address needs an ISO 3166-1 alpha-2 country code", "country": address.Country})
+				return models.ShippingAddress{}, false
+			}
+			return shipping, true
+		}
+	}
+
+	if addressID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address not found"})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user has no default address, an address_id is required"})
+	}
+	return models.ShippingAddress{}, false
 }
 
 func (h *OrderHandler) GetOrderByID(c *gin.Context) {
@@ -78,11 +281,8 @@ func (h *OrderHandler) GetOrderByID(c *gin.Context) {
 	id := c.Param("id")
 	h.logger.Info("Fetching order by id", zap.String("id", id))
 
-	order, err := h.repo.GetOrderByID(id)
-
-	if err != nil {
-		h.logger.Error("error failed to fetch order", zap.Error(err))
-		c.JSON(500, gin.H{"error": "falied to fetch order"})
+	order, ok := h.fetchOrder(c, id)
+	if !ok {
 		return
 	}
 
@@ -91,17 +291,302 @@ func (h *OrderHandler) GetOrderByID(c *gin.Context) {
 
 }
 
+// lists all orders for admins, filtered, sorted and paginated through the query parameters
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	h.listOrders(c, "")
+}
+
+// lists the orders of a user, takes the same query parameters as ListOrders
 func (h *OrderHandler) GetUserOrders(c *gin.Context) {
-	userID := c.Param("id")
-	h.logger.Info("Fetching orders by user id", zap.String("id", userID))
+	id := c.Param("id")
+	h.logger.Info("Fetching orders by user id", zap.String("id", id))
+
+	if callerID, _ := userID(c); id != callerID && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+
+	h.listOrders(c, id)
+}
+
+// listOrders responds with a page of orders, a non empty userID overrides the user filter of the query
+func (h *OrderHandler) listOrders(c *gin.Context, userID string) {
+	var listRequest request.ListOrdersRequest
+	if err := c.ShouldBindQuery(&listRequest); err != nil {
+		h.logger.Error("error binding query", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid query parameters"})
+		return
+	}
+	if userID != "" {
+		listRequest.UserID = userID
+	}
 
-	orders, err := h.repo.GetOrdersByUserID(userID)
+	query, err := mapper.ToOrderQuery(listRequest)
+	if err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+
+	orders, total, err := h.repo.ListOrders(query)
 	if err != nil {
 		h.logger.Error("error failed to fetch orders", zap.Error(err))
 		c.JSON(500, gin.H{"error": "failed to fetch orders"})
 		return
 	}
 
-	orderResponses := mapper.ToOrderResponses(orders)
-	c.JSON(200, gin.H{"orders": orderResponses})
+	c.JSON(200, gin.H{
+		"orders": mapper.ToOrderResponses(orders),
+		"page":   mapper.ToPageResponse(query, total),
+	})
+}
+
+// cancels an order that has not shipped yet and releases its stock back to inventory, the payment of a paid
+// order is refunded in full along with the cancellation
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Cancelling order", zap.String("id", id))
+
+	var cancelRequest request.CancelOrderRequest
+	if err := c.ShouldBindJSON(&cancelRequest); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	order, ok := h.fetchOrder(c, id)
+	if !ok {
+		return
+	}
+
+	if !order.Status.IsCancellable() {
+		h.logger.Warn("refusing to cancel order", zap.String("id", id), zap.String("status", string(order.Status)))
+		c.JSON(http.StatusConflict, gin.H{"error": "order can no longer be cancelled", "status": order.Status})
+		return
+	}
+
+	// Stock is only taken once inventory confirmed the order, pending orders have nothing to give back
+	var events []models.OutboxMessage
+	if order.Status == models.OrderConfirmed || order.Status == models.OrderPaid {
+		release, err := rabbitmq.NewStockRelease(id, mapper.ToItemRequests(order.OrderItems))
+		if err != nil {
+			h.logger.Error("error building stock release", zap.Error(err))
+			c.JSON(500, gin.H{"message": "internal server error"})
+			return
+		}
+		events = append(events, release)
+	}
+
+	change := models.StatusChange{
+		Actor:  actor(c),
+		Reason: cancelRequest.Reason,
+	}
+	var refund *models.Refund
+	var err error
+	if order.Status == models.OrderPaid {
+		refundID := uuid.New().String()
+		var refundEvent models.OutboxMessage
+		refundEvent, err = rabbitmq.NewRefundRequest(refundID, id)
+		if err != nil {
+			h.logger.Error("error building refund request", zap.Error(err))
+			c.JSON(500, gin.H{"message": "internal server error"})
+			return
+		}
+		reason := cancelRequest.Reason
+		if reason == "" {
+			reason = "order cancelled"
+		}
+		refund, err = h.repo.CancelPaidOrder(id, change, func(order *models.Order, captured *models.PaymentAttempt) (*models.Refund, error) {
+			refund, err := order.NewRefund(refundID, captured.Amount, nil, reason, actor(c), false)
+			if err != nil {
+				return nil, err
+			}
+			refund.PaymentRef = captured.ProviderRef
+			return refund, nil
+		}, append(events, refundEvent)...)
+	} else {
+		err = h.repo.TransitionStatus(id, order.Status, models.OrderCancelled, change, events...)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrStatusConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "order status changed, please retry"})
+			return
+		}
+		h.logger.Error("error cancelling order", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to cancel order"})
+		return
+	}
+
+	h.hub.Publish(notify.StatusEvent{
+		OrderID:    id,
+		FromStatus: order.Status,
+		ToStatus:   models.OrderCancelled,
+		Actor:      actor(c),
+		Reason:     cancelRequest.Reason,
+	})
+
+	cancelResponse := gin.H{
+		"message":  "Order cancelled",
+		"order_id": id,
+		"status":   models.OrderCancelled,
+	}
+	if refund != nil {
+		cancelResponse["refund"] = mapper.ToRefundResponse(refund)
+	}
+	c.JSON(http.StatusOK, cancelResponse)
+}
+
+// returns the status change timeline of an order, oldest first
+func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Fetching order history", zap.String("id", id))
+
+	if _, ok := h.fetchOrder(c, id); !ok {
+		return
+	}
+
+	events, err := h.repo.GetStatusHistory(id)
+	if err != nil {
+		h.logger.Error("error failed to fetch order history", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch order history"})
+		return
+	}
+
+	c.JSON(200, gin.H{"order_id": id, "history": mapper.ToStatusEventResponses(events)})
+}
+
+// returns the payment attempts of an order, oldest first
+func (h *OrderHandler) GetOrderPayments(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Fetching order payments", zap.String("id", id))
+
+	if _, ok := h.fetchOrder(c, id); !ok {
+		return
+	}
+
+	attempts, err := h.repo.GetPaymentAttempts(id)
+	if err != nil {
+		h.logger.Error("error failed to fetch order payments", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch order payments"})
+		return
+	}
+
+	c.JSON(200, gin.H{"order_id": id, "payments": mapper.ToPaymentAttemptResponses(attempts)})
+}
+
+// requests a full refund of what is left of the payment, or a partial one for the given items.
+// The refund is processed asynchronously, it starts out as requested
+func (h *OrderHandler) CreateRefund(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Requesting refund", zap.String("id", id))
+
+	var refundRequest request.RefundRequest
+	if err := c.ShouldBindJSON(&refundRequest); err != nil {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	refundID := uuid.New().String()
+	event, err := rabbitmq.NewRefundRequest(refundID, id)
+	if err != nil {
+		h.logger.Error("error building refund request", zap.Error(err))
+		c.JSON(500, gin.H{"message": "internal server error"})
+		return
+	}
+
+	lines := mapper.ToRefundLines(refundRequest.Items)
+	refund, err := h.repo.RequestRefund(id, func(order *models.Order, captured *models.PaymentAttempt) (*models.Refund, error) {
+		refund, err := order.NewRefund(refundID, captured.Amount, lines, refundRequest.Reason, actor(c), refundRequest.Restock)
+		if err != nil {
+			return nil, err
+		}
+		refund.PaymentRef = captured.ProviderRef
+		return refund, nil
+	}, event)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	case errors.Is(err, models.ErrRefundNotAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrInvalidRefund):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Error("error requesting refund", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to request refund"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"refund": mapper.ToRefundResponse(refund)})
+}
+
+// fetchOrder loads an order the logged in user may see, admins see every order.
+// It writes the error response and returns false otherwise
+func (h *OrderHandler) fetchOrder(c *gin.Context, id string) (*models.Order, bool) {
+	order, err := h.repo.GetOrderByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return nil, false
+		}
+		h.logger.Error("error failed to fetch order", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch order"})
+		return nil, false
+	}
+
+	if !ownsOrder(c, order) {
+		h.logger.Warn("refusing access to order of another user", zap.String("id", id), zap.String("actor", actor(c)))
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return nil, false
+	}
+	return order, true
+}
+
+// errNotOrderOwner is returned from repository callbacks when the logged in user does not own the order
+var errNotOrderOwner = errors.New("order belongs to another user")
+
+// ownsOrder reports whether the logged in user placed the order or is an admin
+func ownsOrder(c *gin.Context, order *models.Order) bool {
+	if isAdmin(c) {
+		return true
+	}
+	callerID, ok := userID(c)
+	return ok && order.UserID == callerID
+}
+
+func isAdmin(c *gin.Context) bool {
+	claims, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+	userClaims, ok := claims.(*common.Claims)
+	return ok && userClaims.Role == "admin"
+}
+
+// actor names the logged in user for the order history
+func actor(c *gin.Context) string {
+	claims, exists := c.Get("user")
+	if !exists {
+		return "unknown"
+	}
+	userClaims, ok := claims.(*common.Claims)
+	if !ok || userClaims.Subject == "" {
+		return "unknown"
+	}
+	return userClaims.Subject
+}
+
+// userID returns the id of the logged in user, tokens issued before user ids were added have none
+func userID(c *gin.Context) (string, bool) {
+	claims, exists := c.Get("user")
+	if !exists {
+		return "", false
+	}
+	userClaims, ok := claims.(*common.Claims)
+	if !ok || userClaims.UserID == "" {
+		return "", false
+	}
+	return userClaims.UserID, true
 }
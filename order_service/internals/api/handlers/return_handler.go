@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/order_service/internals/api/dto/request"
+	"github.com/palashbhasme/order_service/internals/api/rabbitmq"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// opens a return for delivered items of an order
+func (h *OrderHandler) CreateReturn(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Opening return", zap.String("id", id))
+
+	var returnRequest request.ReturnRequest
+	if err := c.ShouldBindJSON(&returnRequest); err != nil {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	returnID := uuid.New().String()
+	lines := mapper.ToReturnLines(returnRequest.Items)
+	ret, err := h.repo.CreateReturn(id, func(order *models.Order) (*models.ReturnRequest, error) {
+		if !ownsOrder(c, order) {
+			return nil, errNotOrderOwner
+		}
+		return order.NewReturn(returnID, lines, actor(c))
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	case errors.Is(err, errNotOrderOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	case errors.Is(err, models.ErrReturnNotAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrInvalidReturn):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Error("error opening return", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to open return"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"return": mapper.ToReturnResponse(ret)})
+}
+
+func (h *OrderHandler) GetOrderReturns(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Fetching order returns", zap.String("id", id))
+
+	order, ok := h.fetchOrder(c, id)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, gin.H{"order_id": id, "returns": mapper.ToReturnResponses(order.Returns)})
+}
+
+func (h *OrderHandler) ApproveReturn(c *gin.Context) {
+	h.reviewReturn(c, models.ReturnApproved)
+}
+
+func (h *OrderHandler) RejectReturn(c *gin.Context) {
+	h.reviewReturn(c, models.ReturnRejected)
+}
+
+// marks an approved return as received, its restockable items are sent back to inventory
+func (h *OrderHandler) ReceiveReturn(c *gin.Context) {
+	var receiveRequest request.ReceiveReturnRequest
+	if err := c.ShouldBindJSON(&receiveRequest); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	ret, ok := h.fetchReturn(c)
+	if !ok {
+		return
+	}
+
+	conditions := make(map[string]bool, len(receiveRequest.Items))
+	for _, item := range receiveRequest.Items {
+		conditions[item.OrderItemID] = item.Restockable
+	}
+	for i := range ret.Items {
+		if restockable, ok := conditions[ret.Items[i].OrderItemID]; ok {
+			ret.Items[i].Restockable = restockable
+		}
+	}
+
+	var events []models.OutboxMessage
+	if items := mapper.ReturnItemsToRequests(ret.Items); len(items) > 0 {
+		restock, err := rabbitmq.NewStockRestock("return/"+ret.ID, ret.OrderID, items)
+		if err != nil {
+			h.logger.Error("error building stock restock", zap.Error(err))
+			c.JSON(500, gin.H{"message": "internal server error"})
+			return
+		}
+		events = append(events, restock)
+	}
+
+	now := time.Now()
+	from := ret.Status
+	ret.Status = models.ReturnReceived
+	ret.ReceivedAt = &now
+	h.transitionReturn(c, ret, from, events...)
+}
+
+func (h *OrderHandler) reviewReturn(c *gin.Context, to models.ReturnStatus) {
+	var reviewRequest request.ReviewReturnRequest
+	if err := c.ShouldBindJSON(&reviewRequest); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	ret, ok := h.fetchReturn(c)
+	if !ok {
+		return
+	}
+
+	from := ret.Status
+	ret.Status = to
+	ret.ReviewedBy = actor(c)
+	ret.ResolutionNote = reviewRequest.Note
+	h.transitionReturn(c, ret, from)
+}
+
+func (h *OrderHandler) fetchReturn(c *gin.Context) (*models.ReturnRequest, bool) {
+	ret, err := h.repo.GetReturn(c.Param("id"), c.Param("return_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "return not found"})
+			return nil, false
+		}
+		h.logger.Error("error failed to fetch return", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch return"})
+		return nil, false
+	}
+	return ret, true
+}
+
+func (h *OrderHandler) transitionReturn(c *gin.Context, ret *models.ReturnRequest, from models.ReturnStatus, events ...models.OutboxMessage) {
+	err := h.repo.TransitionReturn(ret, from, events...)
+	switch {
+	case errors.Is(err, models.ErrIllegalTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": "return is " + string(from) + " and cannot become " + string(ret.Status)})
+		return
+	case errors.Is(err, repository.ErrStatusConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "return status changed, please retry"})
+		return
+	case err != nil:
+		h.logger.Error("error updating return", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to update return"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"return": mapper.ToReturnResponse(ret)})
+}
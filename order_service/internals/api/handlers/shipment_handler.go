@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/order_service/internals/api/dto/request"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"github.com/palashbhasme/order_service/internals/notify"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// hands items of a paid order to a carrier, the first shipment moves the order to shipped
+func (h *OrderHandler) CreateShipment(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Creating shipment", zap.String("id", id))
+
+	var shipmentRequest request.ShipmentRequest
+	if err := c.ShouldBindJSON(&shipmentRequest); err != nil {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	shipmentID := uuid.New().String()
+	lines := mapper.ToShipmentLines(shipmentRequest.Items)
+	var from models.OrderStatus
+	shipment, err := h.repo.CreateShipment(id, func(order *models.Order) (*models.Shipment, error) {
+		from = order.Status
+		return order.NewShipment(shipmentID, lines, shipmentRequest.Carrier, shipmentRequest.TrackingNumber, actor(c))
+	}, models.StatusChange{
+		Actor:  actor(c),
+		Reason: "shipped with " + shipmentRequest.Carrier + " " + shipmentRequest.TrackingNumber,
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	case errors.Is(err, models.ErrShipmentNotAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrInvalidShipment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrStatusConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "order status changed, please retry"})
+		return
+	case err != nil:
+		h.logger.Error("error creating shipment", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to create shipment"})
+		return
+	}
+
+	// Only the first shipment of a paid order changes its status
+	if from == models.OrderPaid {
+		h.hub.Publish(notify.StatusEvent{
+			OrderID:    id,
+			FromStatus: from,
+			ToStatus:   models.OrderShipped,
+			Actor:      actor(c),
+			Reason:     "shipped with " + shipmentRequest.Carrier + " " + shipmentRequest.TrackingNumber,
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"shipment": mapper.ToShipmentResponse(shipment)})
+}
+
+// marks a shipment delivered, the order is delivered once all of its items arrived
+func (h *OrderHandler) DeliverShipment(c *gin.Context) {
+	id := c.Param("id")
+	shipmentID := c.Param("shipment_id")
+	h.logger.Info("Delivering shipment", zap.String("id", id), zap.String("shipment_id", shipmentID))
+
+	change := models.StatusChange{
+		Actor:  actor(c),
+		Reason: "all shipments delivered",
+	}
+	shipment, err := h.repo.DeliverShipment(id, shipmentID, change)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "shipment not found"})
+		return
+	case errors.Is(err, repository.ErrShipmentDelivered):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrStatusConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "order status changed, please retry"})
+		return
+	case err != nil:
+		h.logger.Error("error delivering shipment", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to deliver shipment"})
+		return
+	}
+
+	// A delivered order has no undelivered shipment left, so a delivery that finds it delivered completed it
+	if order, err := h.repo.GetOrderByID(id); err == nil && order.Status == models.OrderDelivered {
+		h.hub.Publish(notify.StatusEvent{
+			OrderID:    id,
+			FromStatus: models.OrderShipped,
+			ToStatus:   models.OrderDelivered,
+			Actor:      change.Actor,
+			Reason:     change.Reason,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shipment": mapper.ToShipmentResponse(shipment)})
+}
+
+// returns the shipments of an order with carrier and tracking numbers
+func (h *OrderHandler) GetOrderTracking(c *gin.Context) {
+	id := c.Param("id")
+	h.logger.Info("Fetching order tracking", zap.String("id", id))
+
+	order, ok := h.fetchOrder(c, id)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, gin.H{"tracking": mapper.ToTrackingResponse(order)})
+}
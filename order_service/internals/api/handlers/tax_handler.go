@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/palashbhasme/ecommerce_microservices/common/middlewares"
+	common "github.com/palashbhasme/ecommerce_microservices/common/models"
+	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/order_service/internals/api/dto/request"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type TaxHandler struct {
+	repo   repository.TaxRateRepository
+	logger *zap.Logger
+}
+
+func InitializeTaxHandler(router *gin.Engine, repo repository.TaxRateRepository, logger *zap.Logger) {
+	taxHandler := TaxHandler{
+		repo:   repo,
+		logger: logger,
+	}
+	authconfig := common.NewAuthConfig(os.Getenv("JWT_SECRET"))
+
+	api := router.Group("/api")
+	{
+		taxRoutes := api.Group("/taxes/v1")
+		taxRoutes.Use(middlewares.AuthMiddleware(*authconfig))
+		{
+			taxRoutes.GET("/", taxHandler.GetTaxRates)
+
+			adminRoutes := taxRoutes.Group("/")
+			adminRoutes.Use(middlewares.AdminMiddleware())
+			{
+				adminRoutes.PUT("/", taxHandler.SetTaxRate)
+				adminRoutes.DELETE("/:id", taxHandler.DeleteTaxRate)
+			}
+		}
+	}
+}
+
+func (h *TaxHandler) GetTaxRates(c *gin.Context) {
+	rates, err := h.repo.GetAllTaxRates()
+	if err != nil {
+		h.logger.Error("error failed to fetch tax rates", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to fetch tax rates"})
+		return
+	}
+
+	c.JSON(200, gin.H{"rates": mapper.ToTaxRateResponses(rates)})
+}
+
+// creates or replaces the rate for the country, state and category, orders that were already priced keep their tax
+func (h *TaxHandler) SetTaxRate(c *gin.Context) {
+	var rateRequest request.TaxRateRequest
+	if err := c.ShouldBindJSON(&rateRequest); err != nil {
+		h.logger.Error("error binding request", zap.Error(err))
+		c.JSON(400, gin.H{"message": "invalid request body"})
+		return
+	}
+
+	rate := mapper.ToTaxRateModel(rateRequest)
+	if err := h.repo.UpsertTaxRate(rate); err != nil {
+		h.logger.Error("error saving tax rate", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to save tax rate"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rate": mapper.ToTaxRateResponse(rate)})
+}
+
+func (h *TaxHandler) DeleteTaxRate(c *gin.Context) {
+	err := h.repo.DeleteTaxRate(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tax rate not found"})
+			return
+		}
+		h.logger.Error("error deleting tax rate", zap.Error(err))
+		c.JSON(500, gin.H{"error": "failed to delete tax rate"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Tax rate deleted"})
+}
@@ -1,23 +1,59 @@
 package rabbitmq
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/order_service/internals/domain/models"
 	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"github.com/palashbhasme/order_service/internals/notify"
+	"github.com/palashbhasme/order_service/internals/tax"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
+const updateOrderConsumer = "order_update_consumer"
+
+// orderUpdateRetry gives updates that failed a few delayed retries before they are dead lettered
+var orderUpdateRetry = common.RetryPolicy{
+	Queue:       "order_update",
+	Exchange:    "order_update",
+	RoutingKey:  "order_update_key",
+	DeadLetter:  "order_update_dlx",
+	Delay:       10 * time.Second,
+	MaxAttempts: 5,
+}
+
 type UpdateOrder struct {
-	OrderID string `json:"order_id" binding:"required"`
-	Status  string `json:"status" binding:"required"`
+	OrderID     string        `json:"order_id" binding:"required"`
+	Status      string        `json:"status" binding:"required"`
+	Reason      string        `json:"reason,omitempty"`
+	TotalAmount common.Money  `json:"total_amount"`
+	TaxTotal    *common.Money `json:"tax_total,omitempty"`   // Set on updates about orders that were already taxed
+	Items       []PricedItem  `json:"order_items,omitempty"` // Catalog prices, sent along with a confirmation
+	// Set on cancellations because the stock hold ran out, those only apply to orders that are not paid yet
+	ReservationExpired bool `json:"reservation_expired,omitempty"`
+}
+
+// PricedItem carries the authoritative unit price of an ordered variant and where it sits in the catalog
+type PricedItem struct {
+	ProductID       string        `json:"product_id"`
+	UnitPrice       common.Money  `json:"unit_price"`
+	ParentProductID string        `json:"parent_product_id,omitempty"`
+	CategoryID      string        `json:"category_id,omitempty"`
+	Tax             *common.Money `json:"tax,omitempty"` // Tax on the line, set like UpdateOrder.TaxTotal
 }
 
-func UpdateOrderConsumer(logger *zap.Logger, repo repository.OrdersRepository, conn *amqp.Connection) error {
+func UpdateOrderConsumer(logger *zap.Logger, repo repository.OrdersRepository, hub *notify.Hub, calculator tax.Calculator, conn *amqp.Connection) error {
 	// Open a channel
 	client, err := common.NewRabbitMQClient(conn)
 	if err != nil {
@@ -41,32 +77,171 @@ func UpdateOrderConsumer(logger *zap.Logger, repo repository.OrdersRepository, c
 		logger.Error("error binding queue", zap.Error(err))
 	}
 
-	msgs, err := client.Consume("order_update", "order_update_consumer", false)
+	// Updates that the order state machine refuses, or that keep failing, are parked on a dead letter queue for inspection
+	err = client.DeclareRetry(orderUpdateRetry)
+	if err != nil {
+		logger.Error("Failed to declare retry and dead letter queues", zap.Error(err))
+	}
+
+	msgs, err := client.Consume("order_update", updateOrderConsumer, false)
 	if err != nil {
 		logger.Error("failed to start consuming messages", zap.Error(err))
 		return err
 	}
 
 	for msg := range msgs {
-		var order UpdateOrder
-		if err := json.Unmarshal(msg.Body, &order); err != nil {
+		var update UpdateOrder
+		if err := json.Unmarshal(msg.Body, &update); err != nil {
 			logger.Error("failed to parse message", zap.Error(err))
 			msg.Nack(false, false)
 			continue
 		}
 
-		// Initialize the map
-		status := map[string]interface{}{
-			"status": order.Status,
+		// Deduplication is keyed on the message id, a message without one cannot be processed safely
+		if msg.MessageId == "" {
+			logger.Error("order update has no message id", zap.String("order_id", update.OrderID))
+			deadLetter(client, orderUpdateRetry, msg, "missing message id", logger)
+			continue
 		}
 
-		// Call update order and check error
-		err := repo.UpdateOrderStatus(order.OrderID, status)
+		processed, err := repo.WasProcessed(updateOrderConsumer, msg.MessageId)
 		if err != nil {
-			logger.Error("error updating order status", zap.Error(err))
-			msg.Nack(false, false)
+			logger.Error("error checking processed messages", zap.Error(err))
+			retry(client, orderUpdateRetry, msg, err, logger)
+			continue
+		}
+		if processed {
+			logger.Info("skipping already processed order update", zap.String("order_id", update.OrderID), zap.String("message_id", msg.MessageId))
+			msg.Ack(false)
+			continue
+		}
+
+		to := models.OrderStatus(update.Status)
+		if !to.IsValid() {
+			logger.Error("unknown order status in update", zap.String("order_id", update.OrderID), zap.String("status", update.Status))
+			deadLetter(client, orderUpdateRetry, msg, "unknown status", logger)
+			continue
+		}
+
+		order, err := repo.GetOrderByID(update.OrderID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				logger.Error("order in update does not exist", zap.String("order_id", update.OrderID))
+				deadLetter(client, orderUpdateRetry, msg, "order not found", logger)
+				continue
+			}
+			logger.Error("error fetching order", zap.Error(err))
+			retry(client, orderUpdateRetry, msg, err, logger)
+			continue
+		}
+
+		// The hold can expire while the payment is on its way to inventory, a paid order keeps its stock
+		if update.ReservationExpired && !order.Status.IsAwaitingPayment() {
+			logger.Warn("ignoring expired reservation of an order that is no longer awaiting payment",
+				zap.String("order_id", order.OrderID),
+				zap.String("status", string(order.Status)),
+			)
+			msg.Ack(false)
 			continue
+		}
+
+		// Publishers identify themselves through the app id, fall back to the exchange name
+		actor := msg.AppId
+		if actor == "" {
+			actor = "order_update"
+		}
+
+		change := models.StatusChange{
+			Actor:     actor,
+			Reason:    update.Reason,
+			MessageID: msg.MessageId,
+			Consumer:  updateOrderConsumer,
+		}
+		if to == models.OrderConfirmed && len(update.Items) > 0 {
+			// The payment request carries the order total, so the events are built once the order is priced
+			err = repo.ConfirmOrder(order.OrderID, order.Status, toPricing(update), func(order *models.Order) error {
+				return tax.Apply(calculator, order)
+			}, change, func(order *models.Order) ([]models.OutboxMessage, error) {
+				return statusEvents(order, to)
+			})
 		} else {
+			var events []models.OutboxMessage
+			events, err = statusEvents(order, to)
+			if err != nil {
+				logger.Error("error building order events", zap.Error(err))
+				retry(client, orderUpdateRetry, msg, err, logger)
+				continue
+			}
+			err = repo.TransitionStatus(order.OrderID, order.Status, to, change, events...)
+		}
+		switch {
+		case errors.Is(err, common.ErrDuplicateMessage):
+			msg.Ack(false)
+		case errors.Is(err, models.ErrIllegalTransition):
+			logger.Warn("rejecting illegal order status transition",
+				zap.String("order_id", order.OrderID),
+				zap.String("from", string(order.Status)),
+				zap.String("to", string(to)),
+			)
+			// Inventory already took the stock for an order the customer cancelled meanwhile, give it back
+			if order.Status == models.OrderCancelled && to == models.OrderConfirmed {
+				release, err := NewStockRelease(order.OrderID, mapper.ToItemRequests(order.OrderItems))
+				if err == nil {
+					err = repo.EnqueueOutbox(release)
+				}
+				if err != nil {
+					logger.Error("error releasing stock of cancelled order", zap.Error(err))
+					retry(client, orderUpdateRetry, msg, err, logger)
+					continue
+				}
+			}
+			// The customer cancelled while the payment was being captured, give the money back
+			if order.Status == models.OrderCancelled && to == models.OrderPaid {
+				if err := refundCancelledPayment(repo, order, change); err != nil {
+					logger.Error("error refunding payment of cancelled order", zap.String("order_id", order.OrderID), zap.Error(err))
+					retry(client, orderUpdateRetry, msg, err, logger)
+					continue
+				}
+			}
+			deadLetter(client, orderUpdateRetry, msg, err.Error(), logger)
+		case errors.Is(err, common.ErrCurrencyMismatch), errors.Is(err, tax.ErrNoTaxRate):
+			logger.Error("order cannot be confirmed", zap.String("order_id", order.OrderID), zap.Error(err))
+			// Inventory reserved the stock already, fail the order and give the stock back in one transaction
+			change.Reason = err.Error()
+			release, err := NewStockRelease(order.OrderID, mapper.ToItemRequests(order.OrderItems))
+			if err == nil {
+				err = repo.TransitionStatus(order.OrderID, order.Status, models.OrderFailed, change, release)
+			}
+			switch {
+			case err == nil:
+				hub.Publish(notify.StatusEvent{
+					OrderID:    order.OrderID,
+					FromStatus: order.Status,
+					ToStatus:   models.OrderFailed,
+					Actor:      change.Actor,
+					Reason:     change.Reason,
+				})
+				msg.Ack(false)
+			case errors.Is(err, common.ErrDuplicateMessage):
+				msg.Ack(false)
+			default:
+				logger.Error("error failing order", zap.String("order_id", order.OrderID), zap.Error(err))
+				retry(client, orderUpdateRetry, msg, err, logger)
+			}
+		case errors.Is(err, repository.ErrStatusConflict):
+			// Status moved underneath us, retry against the fresh state
+			retry(client, orderUpdateRetry, msg, err, logger)
+		case err != nil:
+			logger.Error("error updating order status", zap.Error(err))
+			retry(client, orderUpdateRetry, msg, err, logger)
+		default:
+			hub.Publish(notify.StatusEvent{
+				OrderID:    order.OrderID,
+				FromStatus: order.Status,
+				ToStatus:   to,
+				Actor:      change.Actor,
+				Reason:     change.Reason,
+			})
 			msg.Ack(false)
 		}
 	}
@@ -81,3 +256,96 @@ func UpdateOrderConsumer(logger *zap.Logger, repo repository.OrdersRepository, c
 
 	return nil
 }
+
+// refundCancelledPayment requests a full refund of a payment captured for an order that was cancelled meanwhile.
+// The refund id is derived from the update, a redelivered update finds the payment already refunded
+func refundCancelledPayment(repo repository.OrdersRepository, order *models.Order, change models.StatusChange) error {
+	refundID := uuid.NewSHA1(uuid.NameSpaceURL, []byte("cancelled_payment/"+change.MessageID)).String()
+	event, err := NewRefundRequest(refundID, order.OrderID)
+	if err != nil {
+		return err
+	}
+	_, err = repo.RequestRefund(order.OrderID, func(order *models.Order, captured *models.PaymentAttempt) (*models.Refund, error) {
+		refund, err := order.NewRefund(refundID, captured.Amount, nil, "payment captured after the order was cancelled", change.Actor, false)
+		if err != nil {
+			return nil, err
+		}
+		refund.PaymentRef = captured.ProviderRef
+		return refund, nil
+	}, event)
+	if errors.Is(err, models.ErrInvalidRefund) {
+		// Nothing is left to give back
+		return nil
+	}
+	return err
+}
+
+// deadLetter moves a rejected message to the dead letter queue of the policy along with the reason
+func deadLetter(client common.RabbitClient, policy common.RetryPolicy, msg amqp.Delivery, reason string, logger *zap.Logger) {
+	err := client.DeadLetter(context.TODO(), policy.DeadLetter, msg, reason)
+	if err != nil {
+		logger.Error("Failed to dead letter message", zap.Error(err))
+	}
+}
+
+// retry puts a message that failed back on its queue after the delay of the policy,
+// a message that keeps failing ends up on the dead letter queue of the policy
+func retry(client common.RabbitClient, policy common.RetryPolicy, msg amqp.Delivery, cause error, logger *zap.Logger) {
+	deadLettered, err := client.Retry(context.TODO(), policy, msg, cause)
+	if err != nil {
+		logger.Error("Failed to retry message", zap.String("queue", policy.Queue), zap.String("message_id", msg.MessageId), zap.Error(err))
+		return
+	}
+	if deadLettered {
+		logger.Error("giving up on message",
+			zap.String("queue", policy.Queue),
+			zap.String("message_id", msg.MessageId),
+			zap.Int("attempts", common.Attempts(msg)+1),
+			zap.Error(cause),
+		)
+	}
+}
+
+// statusEvents returns the messages that go out with a status change: confirmed orders are sent for payment and invoicing,
+// inventory commits the reserved stock of paid orders and gets back the stock of orders whose payment failed
+func statusEvents(order *models.Order, to models.OrderStatus) ([]models.OutboxMessage, error) {
+	var event models.OutboxMessage
+	var err error
+	switch to {
+	case models.OrderConfirmed:
+		payment, err := NewPaymentRequest(order.OrderID, order.TotalAmount)
+		if err != nil {
+			return nil, err
+		}
+		invoice, err := NewInvoiceRequest(order.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		return []models.OutboxMessage{payment, invoice}, nil
+	case models.OrderPaid:
+		event, err = NewStockCommit(order.OrderID, mapper.ToItemRequests(order.OrderItems))
+	case models.OrderPaymentFailed:
+		event, err = NewStockRelease(order.OrderID, mapper.ToItemRequests(order.OrderItems))
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []models.OutboxMessage{event}, nil
+}
+
+func toPricing(update UpdateOrder) models.OrderPricing {
+	pricing := models.OrderPricing{
+		TotalAmount: update.TotalAmount,
+		Items:       make(map[string]models.PricedVariant, len(update.Items)),
+	}
+	for _, item := range update.Items {
+		pricing.Items[item.ProductID] = models.PricedVariant{
+			UnitPrice:       item.UnitPrice,
+			ParentProductID: item.ParentProductID,
+			CategoryID:      item.CategoryID,
+		}
+	}
+	return pricing
+}
@@ -0,0 +1,129 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/api/clients"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"github.com/palashbhasme/order_service/internals/invoice"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const invoiceRequestConsumer = "invoice_request_consumer"
+
+// invoiceRequestRetry retries invoices the user service or the database failed on, requests that keep failing
+// are dead lettered. An invoice that is still missing is issued when it is first asked for
+var invoiceRequestRetry = common.RetryPolicy{
+	Queue:       "invoice_request",
+	Exchange:    "invoice_request",
+	RoutingKey:  "invoice_request_key",
+	DeadLetter:  "invoice_request_dlx",
+	Delay:       30 * time.Second,
+	MaxAttempts: 5,
+}
+
+// InvoiceConsumer issues the invoices of confirmed orders. Issuing looks up the buyer in the user service, it runs
+// apart from the order updates so a slow user service does not hold them up. Issuing is idempotent, a redelivered
+// request finds the invoice that was issued before
+func InvoiceConsumer(logger *zap.Logger, repo repository.OrdersRepository, invoices *invoice.Issuer, conn *amqp.Connection) error {
+	client, err := common.NewRabbitMQClient(conn)
+	if err != nil {
+		logger.Error("Failed to get a client", zap.Error(err))
+		return err
+	}
+	defer client.Close()
+
+	err = client.CreateExchange("invoice_request", "direct", true, false, false, false)
+	if err != nil {
+		logger.Error("Failed to declare exchange", zap.Error(err))
+		return err
+	}
+	err = client.CreateQueue("invoice_request", true, false)
+	if err != nil {
+		logger.Error("error declaring queue", zap.Error(err))
+		return err
+	}
+	err = client.CreateBinding("invoice_request", "invoice_request_key", "invoice_request")
+	if err != nil {
+		logger.Error("error binding queue", zap.Error(err))
+		return err
+	}
+	err = client.DeclareRetry(invoiceRequestRetry)
+	if err != nil {
+		logger.Error("Failed to declare retry and dead letter queues", zap.Error(err))
+		return err
+	}
+
+	msgs, err := client.Consume("invoice_request", invoiceRequestConsumer, false)
+	if err != nil {
+		logger.Error("failed to start consuming messages", zap.Error(err))
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for msg := range msgs {
+			var request InvoiceRequest
+			if err := json.Unmarshal(msg.Body, &request); err != nil {
+				logger.Error("failed to parse message", zap.Error(err))
+				deadLetter(client, invoiceRequestRetry, msg, "invalid message body", logger)
+				continue
+			}
+
+			order, err := repo.GetOrderByID(request.OrderID)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					logger.Error("order in invoice request does not exist", zap.String("order_id", request.OrderID))
+					deadLetter(client, invoiceRequestRetry, msg, "order not found", logger)
+					continue
+				}
+				logger.Error("error fetching order to invoice", zap.Error(err))
+				retry(client, invoiceRequestRetry, msg, err, logger)
+				continue
+			}
+
+			inv, err := issueInvoice(invoices, order)
+			switch {
+			case errors.Is(err, models.ErrInvoiceNotAllowed):
+				// The order was cancelled before it was invoiced
+				logger.Info("skipping invoice", zap.String("order_id", order.OrderID), zap.Error(err))
+				msg.Ack(false)
+			case errors.Is(err, clients.ErrUserNotFound):
+				logger.Error("buyer of the order not found", zap.String("order_id", order.OrderID), zap.Error(err))
+				deadLetter(client, invoiceRequestRetry, msg, err.Error(), logger)
+			case err != nil:
+				logger.Error("error issuing invoice", zap.String("order_id", order.OrderID), zap.Error(err))
+				retry(client, invoiceRequestRetry, msg, err, logger)
+			default:
+				logger.Info("order invoiced", zap.String("order_id", order.OrderID), zap.String("number", inv.Number))
+				msg.Ack(false)
+			}
+		}
+	}()
+
+	<-sigChan // Wait for termination signal
+
+	logger.Info("Shutting down invoice consumer...")
+
+	return nil
+}
+
+// issueInvoice invoices the order on behalf of the service, unless it already has an invoice
+func issueInvoice(invoices *invoice.Issuer, order *models.Order) (*models.Invoice, error) {
+	token, err := clients.ServiceToken(os.Getenv("JWT_SECRET"))
+	if err != nil {
+		return nil, err
+	}
+	return invoices.Issue(token, order)
+}
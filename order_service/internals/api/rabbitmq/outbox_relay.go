@@ -0,0 +1,105 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+const (
+	outboxPollInterval = 2 * time.Second
+	outboxBatchSize    = 50
+)
+
+// outboxRoutes are the exchanges the relay publishes to, each bound to a durable queue of the same name
+var outboxRoutes = map[string]string{
+	"inventory_check": "inventory_check_key",
+	"stock_release":   "stock_release_key",
+	"stock_commit":    "stock_commit_key",
+	"payment_request": "payment_request_key",
+	"order_update":    "order_update_key",
+	"refund_request":  "refund_request_key",
+	"stock_restock":   "stock_restock_key",
+	"invoice_request": "invoice_request_key",
+}
+
+// OutboxRelay polls the outbox table and publishes unsent messages, failed publishes are retried with backoff
+func OutboxRelay(logger *zap.Logger, repo repository.OutboxRepository, conn *amqp.Connection) error {
+	client, err := common.NewRabbitMQClient(conn)
+	if err != nil {
+		logger.Error("Failed to get a client", zap.Error(err))
+		return err
+	}
+	defer client.Close()
+
+	for exchange, routingKey := range outboxRoutes {
+		err = client.CreateExchange(exchange, "direct", true, false, false, false)
+		if err != nil {
+			logger.Error("Failed to declare exchange", zap.String("exchange", exchange), zap.Error(err))
+			return err
+		}
+		err = client.CreateQueue(exchange, true, false)
+		if err != nil {
+			logger.Error("error declaring queue", zap.String("queue", exchange), zap.Error(err))
+			return err
+		}
+		// Bind here too so messages are not dropped when the relay starts before the consumer
+		err = client.CreateBinding(exchange, routingKey, exchange)
+		if err != nil {
+			logger.Error("error binding queue", zap.String("queue", exchange), zap.Error(err))
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		channelClosed := false
+		sent, err := repo.ProcessOutbox(outboxBatchSize, func(msg models.OutboxMessage) error {
+			if channelClosed {
+				return amqp.ErrClosed
+			}
+			err := client.Send(context.TODO(), msg.Exchange, msg.RoutingKey, amqp.Publishing{
+				ContentType: "application/json",
+				MessageId:   msg.ID,
+				AppId:       "order_service",
+				Body:        msg.Payload,
+			})
+			if err != nil {
+				channelClosed = errors.Is(err, amqp.ErrClosed)
+				logger.Warn("Failed to publish outbox message",
+					zap.String("id", msg.ID),
+					zap.String("exchange", msg.Exchange),
+					zap.Int("attempts", msg.Attempts+1),
+					zap.Error(err),
+				)
+			}
+			return err
+		})
+		if channelClosed {
+			// The broker closes the channel on some publish errors, open a fresh one for the next round
+			client.Close()
+			client, err = common.NewRabbitMQClient(conn)
+			if err != nil {
+				logger.Error("Failed to reopen channel", zap.Error(err))
+				return err
+			}
+		}
+		if err != nil {
+			logger.Error("error processing outbox", zap.Error(err))
+			continue
+		}
+		if sent > 0 {
+			logger.Info("Published outbox messages", zap.Int("count", sent))
+		}
+	}
+
+	return nil
+}
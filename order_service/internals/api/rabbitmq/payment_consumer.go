@@ -0,0 +1,187 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"github.com/palashbhasme/order_service/internals/payments"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const paymentRequestConsumer = "payment_request_consumer"
+
+// paymentRequestRetry retries charges the gateway or the database failed on, requests that keep failing are
+// dead lettered so they do not hammer the gateway
+var paymentRequestRetry = common.RetryPolicy{
+	Queue:       "payment_request",
+	Exchange:    "payment_request",
+	RoutingKey:  "payment_request_key",
+	DeadLetter:  "payment_request_dlx",
+	Delay:       30 * time.Second,
+	MaxAttempts: 5,
+}
+
+// PaymentConsumer collects payment for confirmed orders through the gateway and reports the result on the
+// order_update exchange as paid or payment_failed. The request message id is the idempotency key of the charge,
+// so a redelivery after a crash between charge and commit does not collect twice
+func PaymentConsumer(logger *zap.Logger, repo repository.PaymentRepository, gateway payments.PaymentGateway, conn *amqp.Connection) error {
+	client, err := common.NewRabbitMQClient(conn)
+	if err != nil {
+		logger.Error("Failed to get a client", zap.Error(err))
+		return err
+	}
+	defer client.Close()
+
+	err = client.CreateExchange("payment_request", "direct", true, false, false, false)
+	if err != nil {
+		logger.Error("Failed to declare exchange", zap.Error(err))
+		return err
+	}
+	err = client.CreateQueue("payment_request", true, false)
+	if err != nil {
+		logger.Error("error declaring queue", zap.Error(err))
+		return err
+	}
+	err = client.CreateBinding("payment_request", "payment_request_key", "payment_request")
+	if err != nil {
+		logger.Error("error binding queue", zap.Error(err))
+		return err
+	}
+	err = client.DeclareRetry(paymentRequestRetry)
+	if err != nil {
+		logger.Error("Failed to declare retry and dead letter queues", zap.Error(err))
+		return err
+	}
+
+	msgs, err := client.Consume("payment_request", paymentRequestConsumer, false)
+	if err != nil {
+		logger.Error("failed to start consuming messages", zap.Error(err))
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for msg := range msgs {
+			var request PaymentRequest
+			if err := json.Unmarshal(msg.Body, &request); err != nil {
+				logger.Error("failed to parse message", zap.Error(err))
+				deadLetter(client, paymentRequestRetry, msg, "invalid message body", logger)
+				continue
+			}
+
+			if msg.MessageId == "" {
+				logger.Error("payment request has no message id", zap.String("order_id", request.OrderID))
+				deadLetter(client, paymentRequestRetry, msg, "missing message id", logger)
+				continue
+			}
+
+			processed, err := repo.WasProcessed(paymentRequestConsumer, msg.MessageId)
+			if err != nil {
+				logger.Error("error checking processed messages", zap.Error(err))
+				retry(client, paymentRequestRetry, msg, err, logger)
+				continue
+			}
+			if processed {
+				logger.Info("skipping already processed payment request", zap.String("order_id", request.OrderID), zap.String("message_id", msg.MessageId))
+				msg.Ack(false)
+				continue
+			}
+
+			order, err := repo.GetOrderByID(request.OrderID)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					logger.Error("order in payment request does not exist", zap.String("order_id", request.OrderID))
+					deadLetter(client, paymentRequestRetry, msg, "order not found", logger)
+					continue
+				}
+				logger.Error("error fetching order", zap.Error(err))
+				retry(client, paymentRequestRetry, msg, err, logger)
+				continue
+			}
+
+			// The order may have been cancelled while the request was queued. One cancelled while it is being
+			// charged has its paid update refused, the update consumer refunds the payment then
+			if order.Status != models.OrderConfirmed {
+				logger.Warn("skipping payment for order that is not awaiting payment",
+					zap.String("order_id", order.OrderID),
+					zap.String("status", string(order.Status)),
+				)
+				msg.Ack(false)
+				continue
+			}
+
+			// The order total is authoritative, the amount in the request is informational
+			result, err := gateway.Charge(payments.ChargeRequest{
+				OrderID:        order.OrderID,
+				UserID:         order.UserID,
+				Amount:         order.TotalAmount,
+				IdempotencyKey: msg.MessageId,
+			})
+			if err != nil {
+				logger.Error("error charging order", zap.String("order_id", order.OrderID), zap.Error(err))
+				retry(client, paymentRequestRetry, msg, err, logger)
+				continue
+			}
+
+			attempt := models.PaymentAttempt{
+				OrderID:       order.OrderID,
+				Amount:        order.TotalAmount,
+				Provider:      gateway.Name(),
+				ProviderRef:   result.Reference,
+				Status:        models.PaymentSucceeded,
+				FailureReason: result.DeclineReason,
+				MessageID:     msg.MessageId,
+			}
+			status := models.OrderPaid
+			reason := fmt.Sprintf("payment %s captured by %s", result.Reference, gateway.Name())
+			if !result.Approved {
+				attempt.Status = models.PaymentDeclined
+				status = models.OrderPaymentFailed
+				reason = fmt.Sprintf("payment %s declined by %s: %s", result.Reference, gateway.Name(), result.DeclineReason)
+			}
+
+			update, err := NewOrderUpdate(order, status, reason)
+			if err != nil {
+				logger.Error("error building order update", zap.Error(err))
+				retry(client, paymentRequestRetry, msg, err, logger)
+				continue
+			}
+
+			err = repo.RecordPaymentAttempt(paymentRequestConsumer, msg.MessageId, &attempt, update)
+			if errors.Is(err, common.ErrDuplicateMessage) {
+				msg.Ack(false)
+				continue
+			}
+			if err != nil {
+				logger.Error("error recording payment attempt", zap.String("order_id", order.OrderID), zap.Error(err))
+				retry(client, paymentRequestRetry, msg, err, logger)
+				continue
+			}
+
+			logger.Info("Payment processed",
+				zap.String("order_id", order.OrderID),
+				zap.String("status", string(status)),
+				zap.String("reference", result.Reference),
+			)
+			msg.Ack(false)
+		}
+	}()
+
+	<-sigChan // Wait for termination signal
+
+	logger.Info("Shutting down payment consumer...")
+
+	return nil
+}
@@ -1,73 +1,165 @@
 package rabbitmq
 
 import (
-	"context"
 	"encoding/json"
 
+	"github.com/google/uuid"
 	"github.com/palashbhasme/ecommerce_microservices/common"
 	"github.com/palashbhasme/order_service/internals/api/dto/request"
-	amqp "github.com/rabbitmq/amqp091-go"
-	"go.uber.org/zap"
+	"github.com/palashbhasme/order_service/internals/domain/models"
 )
 
 // Struct for inventory check message
 type InventoryRequest struct {
-	OrderID string                 `json:"order_id"`
-	Items   []request.OrderItemReq `json:"order_items"`
+	OrderID  string                 `json:"order_id"`
+	Source   string                 `json:"source,omitempty"`   // What a restock is for, inventory books returns apart
+	Currency string                 `json:"currency,omitempty"` // Inventory prices the order in this currency
+	Items    []request.OrderItemReq `json:"order_items"`
 }
 
-// PublishInventoryCheck sends an order inventory check request via RabbitMQ
-func PublishInventoryCheck(orderID string, items []request.OrderItemReq, logger *zap.Logger, conn *amqp.Connection) error {
+// NewInventoryCheck builds the outbox message asking inventory to reserve stock for a new order
+func NewInventoryCheck(orderID, currency string, items []request.OrderItemReq) (models.OutboxMessage, error) {
+	return newOutboxMessage("inventory_check", "inventory_check_key", InventoryRequest{
+		OrderID:  orderID,
+		Currency: currency,
+		Items:    items,
+	})
+}
 
-	client, err := common.NewRabbitMQClient(conn)
+// NewStockRelease builds the outbox message asking inventory to put back the stock held by a cancelled order.
+// The release payload has the same shape as the inventory check
+// The message id is derived from the order so its stock can never be released twice
+func NewStockRelease(orderID string, items []request.OrderItemReq) (models.OutboxMessage, error) {
+	msg, err := newOutboxMessage("stock_release", "stock_release_key", InventoryRequest{
+		OrderID: orderID,
+		Items:   items,
+	})
 	if err != nil {
-		logger.Error("Failed to get a client", zap.Error(err))
-		return err
+		return msg, err
 	}
-	defer client.Close()
+	msg.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte("stock_release/"+orderID)).String()
+	return msg, nil
+}
 
-	// Declare the exchange (should be "direct" if using a specific routing key)
-	err = client.CreateExchange("inventory_check", "direct", true, false, false, false)
+// NewStockCommit builds the outbox message telling inventory to take the stock reserved for the order
+// off its on-hand stock. Like the release its message id is derived from the order
+func NewStockCommit(orderID string, items []request.OrderItemReq) (models.OutboxMessage, error) {
+	msg, err := newOutboxMessage("stock_commit", "stock_commit_key", InventoryRequest{
+		OrderID: orderID,
+		Items:   items,
+	})
 	if err != nil {
-		logger.Error("Failed to declare exchange", zap.Error(err))
-		return err
+		return msg, err
 	}
-	// Declare queue
-	err = client.CreateQueue("inventory_check", true, false)
+	msg.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte("stock_commit/"+orderID)).String()
+	return msg, nil
+}
+
+// PaymentRequest asks the payment consumer to collect the amount of a confirmed order
+type PaymentRequest struct {
+	OrderID string       `json:"order_id"`
+	Amount  common.Money `json:"amount"`
+}
+
+// NewPaymentRequest builds the outbox message asking for payment once inventory confirmed the order.
+// The message id is derived from the order and doubles as the idempotency key of the charge
+func NewPaymentRequest(orderID string, amount common.Money) (models.OutboxMessage, error) {
+	msg, err := newOutboxMessage("payment_request", "payment_request_key", PaymentRequest{
+		OrderID: orderID,
+		Amount:  amount,
+	})
 	if err != nil {
-		logger.Fatal("error declaring queue", zap.Error(err))
-		return err
+		return msg, err
 	}
-	// Create the inventory request payload
-	inventoryRequest := InventoryRequest{
+	msg.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte("payment_request/"+orderID)).String()
+	return msg, nil
+}
+
+// InvoiceRequest asks the invoice consumer to issue the invoice of a confirmed order
+type InvoiceRequest struct {
+	OrderID string `json:"order_id"`
+}
+
+// NewInvoiceRequest builds the outbox message that gets a confirmed order invoiced apart from the order updates.
+// The message id is derived from the order, it is only asked to be invoiced once
+func NewInvoiceRequest(orderID string) (models.OutboxMessage, error) {
+	msg, err := newOutboxMessage("invoice_request", "invoice_request_key", InvoiceRequest{
 		OrderID: orderID,
-		Items:   items,
+	})
+	if err != nil {
+		return msg, err
 	}
+	msg.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte("invoice_request/"+orderID)).String()
+	return msg, nil
+}
 
-	body, err := json.Marshal(inventoryRequest)
-	if err != nil {
-		logger.Error("Failed to marshal JSON", zap.Error(err))
-		return err
+// NewOrderUpdate builds an outbox message for the order_update exchange, the same way other services report
+// status changes of an order. The order amounts with their tax breakdown go along for other listeners
+func NewOrderUpdate(order *models.Order, status models.OrderStatus, reason string) (models.OutboxMessage, error) {
+	update := UpdateOrder{
+		OrderID:     order.OrderID,
+		Status:      string(status),
+		Reason:      reason,
+		TotalAmount: order.TotalAmount,
+		TaxTotal:    &order.TaxTotal,
+		Items:       make([]PricedItem, 0, len(order.OrderItems)),
+	}
+	for _, item := range order.OrderItems {
+		update.Items = append(update.Items, PricedItem{
+			ProductID:       item.ProductID,
+			UnitPrice:       item.Price,
+			ParentProductID: item.ParentProductID,
+			CategoryID:      item.CategoryID,
+			Tax:             &item.Tax,
+		})
 	}
+	return newOutboxMessage("order_update", "order_update_key", update)
+}
 
-	// Publish message to the exchange
+// RefundRequestEvent asks the refund consumer to give back the money of a requested refund
+type RefundRequestEvent struct {
+	RefundID string `json:"refund_id"`
+	OrderID  string `json:"order_id"`
+}
 
-	err = client.Send(context.TODO(), "inventory_check", "inventory_check_key",
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		})
+// NewRefundRequest builds the outbox message that gets a requested refund processed at the gateway.
+// The message id is derived from the refund and doubles as the idempotency key of the refund
+func NewRefundRequest(refundID, orderID string) (models.OutboxMessage, error) {
+	msg, err := newOutboxMessage("refund_request", "refund_request_key", RefundRequestEvent{
+		RefundID: refundID,
+		OrderID:  orderID,
+	})
+	if err != nil {
+		return msg, err
+	}
+	msg.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte("refund_request/"+refundID)).String()
+	return msg, nil
+}
 
+// NewStockRestock builds the outbox message asking inventory to put refunded or returned items back on stock.
+// The source names what is being restocked, e.g. "refund/<id>", so it can only happen once
+func NewStockRestock(source, orderID string, items []request.OrderItemReq) (models.OutboxMessage, error) {
+	msg, err := newOutboxMessage("stock_restock", "stock_restock_key", InventoryRequest{
+		OrderID: orderID,
+		Source:  source,
+		Items:   items,
+	})
 	if err != nil {
-		logger.Error("Failed to publish message", zap.Error(err))
-		return err
+		return msg, err
 	}
+	msg.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte("stock_restock/"+source)).String()
+	return msg, nil
+}
 
-	logger.Info("Successfully published inventory check",
-		zap.String("exchange", "inventory_check"),
-		zap.String("routing_key", "inventory_check_key"),
-		zap.String("order_id", orderID),
-	)
+func newOutboxMessage(exchange, routingKey string, payload interface{}) (models.OutboxMessage, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
 
-	return nil
+	return models.OutboxMessage{
+		Exchange:   exchange,
+		RoutingKey: routingKey,
+		Payload:    body,
+	}, nil
 }
@@ -0,0 +1,178 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/api/dto/mapper"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"github.com/palashbhasme/order_service/internals/payments"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const refundRequestConsumer = "refund_request_consumer"
+
+// refundRequestRetry retries refunds the gateway or the database failed on. A refund the gateway keeps failing
+// on is marked failed on the last attempt, so it shows up on the order instead of staying requested
+var refundRequestRetry = common.RetryPolicy{
+	Queue:       "refund_request",
+	Exchange:    "refund_request",
+	RoutingKey:  "refund_request_key",
+	DeadLetter:  "refund_request_dlx",
+	Delay:       30 * time.Second,
+	MaxAttempts: 5,
+}
+
+// RefundConsumer gives back the money of requested refunds through the gateway and marks them processed or failed.
+// Processed refunds that asked for it send their items back to inventory
+func RefundConsumer(logger *zap.Logger, repo repository.RefundRepository, gateway payments.PaymentGateway, conn *amqp.Connection) error {
+	client, err := common.NewRabbitMQClient(conn)
+	if err != nil {
+		logger.Error("Failed to get a client", zap.Error(err))
+		return err
+	}
+	defer client.Close()
+
+	err = client.CreateExchange("refund_request", "direct", true, false, false, false)
+	if err != nil {
+		logger.Error("Failed to declare exchange", zap.Error(err))
+		return err
+	}
+	err = client.CreateQueue("refund_request", true, false)
+	if err != nil {
+		logger.Error("error declaring queue", zap.Error(err))
+		return err
+	}
+	err = client.CreateBinding("refund_request", "refund_request_key", "refund_request")
+	if err != nil {
+		logger.Error("error binding queue", zap.Error(err))
+		return err
+	}
+	err = client.DeclareRetry(refundRequestRetry)
+	if err != nil {
+		logger.Error("Failed to declare retry and dead letter queues", zap.Error(err))
+		return err
+	}
+
+	msgs, err := client.Consume("refund_request", refundRequestConsumer, false)
+	if err != nil {
+		logger.Error("failed to start consuming messages", zap.Error(err))
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for msg := range msgs {
+			var request RefundRequestEvent
+			if err := json.Unmarshal(msg.Body, &request); err != nil {
+				logger.Error("failed to parse message", zap.Error(err))
+				deadLetter(client, refundRequestRetry, msg, "invalid message body", logger)
+				continue
+			}
+
+			if msg.MessageId == "" {
+				logger.Error("refund request has no message id", zap.String("refund_id", request.RefundID))
+				deadLetter(client, refundRequestRetry, msg, "missing message id", logger)
+				continue
+			}
+
+			processed, err := repo.WasProcessed(refundRequestConsumer, msg.MessageId)
+			if err != nil {
+				logger.Error("error checking processed messages", zap.Error(err))
+				retry(client, refundRequestRetry, msg, err, logger)
+				continue
+			}
+			if processed {
+				logger.Info("skipping already processed refund request", zap.String("refund_id", request.RefundID), zap.String("message_id", msg.MessageId))
+				msg.Ack(false)
+				continue
+			}
+
+			refund, err := repo.GetRefund(request.RefundID)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					logger.Error("refund in request does not exist", zap.String("refund_id", request.RefundID))
+					deadLetter(client, refundRequestRetry, msg, "refund not found", logger)
+					continue
+				}
+				logger.Error("error fetching refund", zap.Error(err))
+				retry(client, refundRequestRetry, msg, err, logger)
+				continue
+			}
+			if refund.Status != models.RefundRequested {
+				msg.Ack(false)
+				continue
+			}
+
+			result, err := gateway.Refund(payments.RefundRequest{
+				OrderID:        refund.OrderID,
+				PaymentRef:     refund.PaymentRef,
+				Amount:         refund.Amount,
+				IdempotencyKey: msg.MessageId,
+			})
+			if err != nil {
+				logger.Error("error refunding order", zap.String("refund_id", refund.ID), zap.Error(err))
+				attempts := common.Attempts(msg) + 1
+				if attempts < refundRequestRetry.MaxAttempts {
+					retry(client, refundRequestRetry, msg, err, logger)
+					continue
+				}
+				// Out of attempts, the refund fails so admins see that the money was not given back
+				result = payments.RefundResult{DeclineReason: fmt.Sprintf("gave up after %d attempts: %v", attempts, err)}
+			}
+
+			var events []models.OutboxMessage
+			refund.ProviderRef = result.Reference
+			if result.Approved {
+				refund.Status = models.RefundProcessed
+				if refund.Restock && len(refund.Items) > 0 {
+					restock, err := NewStockRestock("refund/"+refund.ID, refund.OrderID, mapper.RefundItemsToRequests(refund.Items))
+					if err != nil {
+						logger.Error("error building stock restock", zap.Error(err))
+						retry(client, refundRequestRetry, msg, err, logger)
+						continue
+					}
+					events = append(events, restock)
+				}
+			} else {
+				refund.Status = models.RefundFailed
+				refund.FailureReason = result.DeclineReason
+			}
+
+			err = repo.CompleteRefund(refundRequestConsumer, msg.MessageId, refund, events...)
+			if errors.Is(err, common.ErrDuplicateMessage) || errors.Is(err, repository.ErrRefundConflict) {
+				msg.Ack(false)
+				continue
+			}
+			if err != nil {
+				logger.Error("error completing refund", zap.String("refund_id", refund.ID), zap.Error(err))
+				retry(client, refundRequestRetry, msg, err, logger)
+				continue
+			}
+
+			logger.Info("Refund processed",
+				zap.String("refund_id", refund.ID),
+				zap.String("order_id", refund.OrderID),
+				zap.String("status", string(refund.Status)),
+			)
+			msg.Ack(false)
+		}
+	}()
+
+	<-sigChan // Wait for termination signal
+
+	logger.Info("Shutting down refund consumer...")
+
+	return nil
+}
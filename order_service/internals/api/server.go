@@ -1,10 +1,21 @@
 package internals
 
 import (
+	"os"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/api/clients"
 	"github.com/palashbhasme/order_service/internals/api/handlers"
 	"github.com/palashbhasme/order_service/internals/api/rabbitmq"
 	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"github.com/palashbhasme/order_service/internals/invoice"
+	"github.com/palashbhasme/order_service/internals/notify"
+	"github.com/palashbhasme/order_service/internals/payments"
+	"github.com/palashbhasme/order_service/internals/tax"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -17,14 +28,67 @@ func Server(logger *zap.Logger, db *gorm.DB, rabbitmqconfig *rabbitmq.RabbitMQCo
 		logger.Error("Failed to connect to rabbit mq", zap.Error(err))
 	}
 
+	gateway := payments.NewMockGateway()
+	hub := notify.NewHub()
+	calculator := tax.NewTableCalculator(repo)
+	users := clients.NewHTTPUserClient(os.Getenv("USER_SERVICE_URL"))
+	invoices := invoice.NewIssuer(repo, users)
+
 	go func() {
-		if err := rabbitmq.UpdateOrderConsumer(logger, repo, conn.Conn); err != nil {
+		if err := rabbitmq.UpdateOrderConsumer(logger, repo, hub, calculator, conn.Conn); err != nil {
 			logger.Error("error calling update order publisher", zap.Error(err))
 		}
 	}()
 
+	go func() {
+		if err := rabbitmq.InvoiceConsumer(logger, repo, invoices, conn.Conn); err != nil {
+			logger.Error("invoice consumer stopped", zap.Error(err))
+		}
+	}()
+
+	go func() {
+		if err := rabbitmq.PaymentConsumer(logger, repo, gateway, conn.Conn); err != nil {
+			logger.Error("payment consumer stopped", zap.Error(err))
+		}
+	}()
+
+	go func() {
+		if err := rabbitmq.RefundConsumer(logger, repo, gateway, conn.Conn); err != nil {
+			logger.Error("refund consumer stopped", zap.Error(err))
+		}
+	}()
+
+	go func() {
+		if err := rabbitmq.OutboxRelay(logger, repo, conn.Conn); err != nil {
+			logger.Error("outbox relay stopped", zap.Error(err))
+		}
+	}()
+
+	// Retries of an order request with the same Idempotency-Key get the first response within the TTL
+	idempotencyTTL := 24 * time.Hour
+	if ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_KEY_TTL")); err == nil && ttl > 0 {
+		idempotencyTTL = ttl
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := repo.PurgeIdempotencyKeys(time.Now()); err != nil {
+				logger.Error("error purging expired idempotency keys", zap.Error(err))
+			}
+		}
+	}()
+
+	// Money fields are validated by their amount, so binding tags like gt=0 work on prices
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterCustomTypeFunc(common.MoneyAmount, common.Money{})
+	}
 	router := gin.Default()
-	handlers.InitializeOrderHandler(router, repo, logger, conn)
+	handlers.InitializeOrderHandler(router, repo, users, invoices, hub, idempotencyTTL, logger)
+	handlers.InitializeCartHandler(router, repo, clients.NewHTTPInventoryClient(os.Getenv("INVENTORY_SERVICE_URL")), users, logger)
+	handlers.InitializeCouponHandler(router, repo, logger)
+	handlers.InitializeTaxHandler(router, repo, logger)
 	err = router.Run(":8082")
 	if err != nil {
 		return err
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+// Carts Model, every user has at most one cart which is emptied on checkout
+type Cart struct {
+	ID        string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID    string     `gorm:"not null;uniqueIndex"`
+	Currency  string     `gorm:"type:char(3);not null;default:'USD'"`
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime"`
+	Items     []CartItem `gorm:"foreignKey:CartID;constraint:OnDelete:CASCADE;"`
+}
+
+// CartItems Model, one line per product variant
+type CartItem struct {
+	ID        string       `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CartID    string       `gorm:"not null;uniqueIndex:idx_cart_variant"`
+	VariantID string       `gorm:"not null;uniqueIndex:idx_cart_variant"` // Inventory product variant id
+	Quantity  int          `gorm:"not null"`
+	UnitPrice common.Money `gorm:"embedded;embeddedPrefix:unit_price_"` // Catalog price when the item was last validated
+	CreatedAt time.Time    `gorm:"autoCreateTime"`
+	UpdatedAt time.Time    `gorm:"autoUpdateTime"`
+}
+
+// TotalQuantity is the number of units in the cart
+func (c *Cart) TotalQuantity() int {
+	quantity := 0
+	for _, item := range c.Items {
+		quantity += item.Quantity
+	}
+	return quantity
+}
+
+// Subtotal adds up the last validated prices of the cart items
+func (c *Cart) Subtotal() (common.Money, error) {
+	subtotal := common.Zero(c.Currency)
+	for _, item := range c.Items {
+		var err error
+		subtotal, err = subtotal.Add(item.UnitPrice.Mul(int64(item.Quantity)))
+		if err != nil {
+			return common.Money{}, err
+		}
+	}
+	return subtotal, nil
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+type CouponType string
+
+const (
+	CouponPercentage  CouponType = "percentage"
+	CouponFixedAmount CouponType = "fixed_amount"
+)
+
+type RestrictionKind string
+
+const (
+	RestrictProduct  RestrictionKind = "product"
+	RestrictCategory RestrictionKind = "category"
+)
+
+var (
+	// ErrInvalidCoupon is returned for coupon definitions that cannot be applied to any order
+	ErrInvalidCoupon = errors.New("invalid coupon")
+	// ErrCouponNotApplicable is returned when a coupon cannot be used for an order
+	ErrCouponNotApplicable = errors.New("coupon cannot be applied")
+)
+
+// Coupons Model, a code that takes a percentage or a fixed amount off the items it applies to
+type Coupon struct {
+	ID             string              `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Code           string              `gorm:"type:varchar(64);uniqueIndex;not null"` // Stored upper case
+	Type           CouponType          `gorm:"type:varchar(20);not null"`
+	PercentOff     int                 // 1 to 100, percentage coupons only
+	AmountOff      *common.Money       `gorm:"embedded;embeddedPrefix:amount_off_"`      // Fixed amount coupons only, spread over the eligible items
+	MinOrderValue  *common.Money       `gorm:"embedded;embeddedPrefix:min_order_value_"` // Catalog subtotal the order has to reach
+	StartsAt       *time.Time          // Open ended when nil
+	EndsAt         *time.Time          // Open ended when nil
+	MaxUses        int                 // Across all users, 0 is unlimited
+	MaxUsesPerUser int                 // 0 is unlimited
+	Active         bool                `gorm:"not null;default:true"`
+	CreatedBy      string              `gorm:"type:varchar(255)"`
+	CreatedAt      time.Time           `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time           `gorm:"autoUpdateTime"`
+	Restrictions   []CouponRestriction `gorm:"foreignKey:CouponID;constraint:OnDelete:CASCADE;"` // None means every item
+}
+
+// CouponRestrictions Model, limits a coupon to inventory products or categories
+type CouponRestriction struct {
+	ID       string          `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CouponID string          `gorm:"not null;index"`
+	Kind     RestrictionKind `gorm:"type:varchar(20);not null"`
+	RefID    string          `gorm:"type:varchar(64);not null"` // Inventory product or category id
+}
+
+// CouponRedemptions Model, one use of a coupon by an order. Redemptions of cancelled orders do not count
+type CouponRedemption struct {
+	ID        string       `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	CouponID  string       `gorm:"not null;index"`
+	OrderID   string       `gorm:"type:uuid;not null;uniqueIndex"`
+	UserID    string       `gorm:"not null;index"`
+	Amount    common.Money `gorm:"embedded;embeddedPrefix:amount_"` // Known once the order is priced
+	CreatedAt time.Time    `gorm:"autoCreateTime"`
+}
+
+// Validate checks that the coupon definition is complete and consistent
+func (c *Coupon) Validate() error {
+	switch c.Type {
+	case CouponPercentage:
+		if c.PercentOff < 1 || c.PercentOff > 100 {
+			return fmt.Errorf("%w: percent off has to be between 1 and 100", ErrInvalidCoupon)
+		}
+		if c.AmountOff != nil {
+			return fmt.Errorf("%w: percentage coupons take no amount off", ErrInvalidCoupon)
+		}
+	case CouponFixedAmount:
+		if c.AmountOff == nil || c.AmountOff.IsZero() || c.AmountOff.IsNegative() {
+			return fmt.Errorf("%w: fixed amount coupons need a positive amount off", ErrInvalidCoupon)
+		}
+		if c.PercentOff != 0 {
+			return fmt.Errorf("%w: fixed amount coupons take no percent off", ErrInvalidCoupon)
+		}
+		if c.MinOrderValue != nil && c.MinOrderValue.Currency != c.AmountOff.Currency {
+			return fmt.Errorf("%w: minimum order value and amount off are in different currencies", ErrInvalidCoupon)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidCoupon, c.Type)
+	}
+	if c.StartsAt != nil && c.EndsAt != nil && !c.EndsAt.After(*c.StartsAt) {
+		return fmt.Errorf("%w: coupon ends before it starts", ErrInvalidCoupon)
+	}
+	if c.MaxUses < 0 || c.MaxUsesPerUser < 0 {
+		return fmt.Errorf("%w: usage limits cannot be negative", ErrInvalidCoupon)
+	}
+	for _, restriction := range c.Restrictions {
+		if restriction.Kind != RestrictProduct && restriction.Kind != RestrictCategory {
+			return fmt.Errorf("%w: unknown restriction %q", ErrInvalidCoupon, restriction.Kind)
+		}
+	}
+	return nil
+}
+
+// CheckRedeemable reports why the coupon cannot be used at the time for an order in the currency.
+// Amounts of a coupon are only valid in their own currency. Usage limits are checked by the repository
+func (c *Coupon) CheckRedeemable(now time.Time, currency string) error {
+	switch {
+	case !c.Active:
+		return fmt.Errorf("%w: coupon %s is not active", ErrCouponNotApplicable, c.Code)
+	case c.StartsAt != nil && now.Before(*c.StartsAt):
+		return fmt.Errorf("%w: coupon %s is not valid yet", ErrCouponNotApplicable, c.Code)
+	case c.EndsAt != nil && !now.Before(*c.EndsAt):
+		return fmt.Errorf("%w: coupon %s has expired", ErrCouponNotApplicable, c.Code)
+	case c.AmountOff != nil && c.AmountOff.Currency != currency:
+		return fmt.Errorf("%w: coupon %s is only valid for orders in %s", ErrCouponNotApplicable, c.Code, c.AmountOff.Currency)
+	case c.MinOrderValue != nil && c.MinOrderValue.Currency != currency:
+		return fmt.Errorf("%w: coupon %s is only valid for orders in %s", ErrCouponNotApplicable, c.Code, c.MinOrderValue.Currency)
+	}
+	return nil
+}
+
+// AppliesTo reports whether the coupon discounts the order item, restrictions match the catalog
+// product, the ordered variant itself or the category
+func (c *Coupon) AppliesTo(item *OrderItem) bool {
+	if len(c.Restrictions) == 0 {
+		return true
+	}
+	for _, restriction := range c.Restrictions {
+		switch restriction.Kind {
+		case RestrictProduct:
+			if restriction.RefID == item.ParentProductID || restriction.RefID == item.ProductID {
+				return true
+			}
+		case RestrictCategory:
+			if item.CategoryID != "" && restriction.RefID == item.CategoryID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ApplyCoupon discounts the catalog priced order. Percentage coupons take their share off every eligible line,
+// fixed amounts are spread over the eligible lines in proportion to their totals and never exceed them.
+// An order below the minimum value or without eligible items gets no discount and ErrCouponNotApplicable
+func (o *Order) ApplyCoupon(c *Coupon) error {
+	o.CouponCode = c.Code
+	o.DiscountTotal = common.Zero(o.Subtotal.Currency)
+	o.TotalAmount = o.Subtotal
+	for i := range o.OrderItems {
+		o.OrderItems[i].Discount = common.Zero(o.Subtotal.Currency)
+	}
+
+	if c.MinOrderValue != nil {
+		cmp, err := o.Subtotal.Cmp(*c.MinOrderValue)
+		if err != nil {
+			return err
+		}
+		if cmp < 0 {
+			return fmt.Errorf("%w: order total %s is below the minimum of %s", ErrCouponNotApplicable, o.Subtotal, c.MinOrderValue)
+		}
+	}
+
+	var eligible []*OrderItem
+	var eligibleTotal int64
+	for i := range o.OrderItems {
+		item := &o.OrderItems[i]
+		if c.AppliesTo(item) {
+			eligible = append(eligible, item)
+			eligibleTotal += item.Price.Mul(int64(item.Quantity)).Amount
+		}
+	}
+	if eligibleTotal == 0 {
+		return fmt.Errorf("%w: no item of the order qualifies for coupon %s", ErrCouponNotApplicable, c.Code)
+	}
+
+	var discounted int64
+	switch c.Type {
+	case CouponPercentage:
+		for _, item := range eligible {
+			line := item.Price.Mul(int64(item.Quantity)).Amount
+			item.Discount.Amount = (line*int64(c.PercentOff) + 50) / 100
+			discounted += item.Discount.Amount
+		}
+	case CouponFixedAmount:
+		total := min(c.AmountOff.Amount, eligibleTotal)
+		for _, item := range eligible {
+			line := item.Price.Mul(int64(item.Quantity)).Amount
+			item.Discount.Amount = total * line / eligibleTotal
+			discounted += item.Discount.Amount
+		}
+		// Cents lost to rounding go to the first lines that still have room
+		for _, item := range eligible {
+			if discounted == total {
+				break
+			}
+			if item.Discount.Amount < item.Price.Mul(int64(item.Quantity)).Amount {
+				item.Discount.Amount++
+				discounted++
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidCoupon, c.Type)
+	}
+
+	o.DiscountTotal.Amount = discounted
+	o.TotalAmount.Amount = o.Subtotal.Amount - discounted
+	return nil
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+type testLine struct {
+	id       string
+	price    int64
+	quantity int
+	parent   string
+	category string
+}
+
+// pricedOrder builds a catalog priced USD order out of the lines
+func pricedOrder(lines ...testLine) *Order {
+	order := &Order{OrderID: "order", Currency: "USD"}
+	var subtotal int64
+	for _, line := range lines {
+		order.OrderItems = append(order.OrderItems, OrderItem{
+			ID:              line.id,
+			ProductID:       "variant-" + line.id,
+			Price:           common.NewMoney(line.price, "USD"),
+			Quantity:        line.quantity,
+			ParentProductID: line.parent,
+			CategoryID:      line.category,
+		})
+		subtotal += line.price * int64(line.quantity)
+	}
+	order.Subtotal = common.NewMoney(subtotal, "USD")
+	order.TotalAmount = order.Subtotal
+	return order
+}
+
+func usd(amount int64) *common.Money {
+	money := common.NewMoney(amount, "USD")
+	return &money
+}
+
+func TestApplyCoupon(t *testing.T) {
+	tests := []struct {
+		name      string
+		coupon    Coupon
+		lines     []testLine
+		discounts []int64 // Per line, in order
+		total     int64
+		err       error
+	}{
+		{
+			name:      "percentage on every line",
+			coupon:    Coupon{Code: "TEN", Type: CouponPercentage, PercentOff: 10},
+			lines:     []testLine{{id: "a", price: 1999, quantity: 1}, {id: "b", price: 500, quantity: 3}},
+			discounts: []int64{200, 150},
+			total:     3149,
+		},
+		{
+			name:      "percentage rounds half cents up",
+			coupon:    Coupon{Code: "TEN", Type: CouponPercentage, PercentOff: 10},
+			lines:     []testLine{{id: "a", price: 125, quantity: 1}, {id: "b", price: 124, quantity: 1}},
+			discounts: []int64{13, 12},
+			total:     224,
+		},
+		{
+			name:      "full percentage",
+			coupon:    Coupon{Code: "FREE", Type: CouponPercentage, PercentOff: 100},
+			lines:     []testLine{{id: "a", price: 999, quantity: 2}},
+			discounts: []int64{1998},
+			total:     0,
+		},
+		{
+			name:      "fixed amount spread in proportion",
+			coupon:    Coupon{Code: "FIVE", Type: CouponFixedAmount, AmountOff: usd(600)},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 1}, {id: "b", price: 1000, quantity: 2}},
+			discounts: []int64{200, 400},
+			total:     2400,
+		},
+		{
+			name:      "fixed amount gives cents lost to rounding to the first lines",
+			coupon:    Coupon{Code: "TENNER", Type: CouponFixedAmount, AmountOff: usd(1000)},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 1}, {id: "b", price: 1000, quantity: 1}, {id: "c", price: 1000, quantity: 1}},
+			discounts: []int64{334, 333, 333},
+			total:     2000,
+		},
+		{
+			name:      "fixed amount skips lines without room for another cent",
+			coupon:    Coupon{Code: "TWO", Type: CouponFixedAmount, AmountOff: usd(2)},
+			lines:     []testLine{{id: "a", price: 1, quantity: 1}, {id: "b", price: 1, quantity: 1}, {id: "c", price: 1, quantity: 1}},
+			discounts: []int64{1, 1, 0},
+			total:     1,
+		},
+		{
+			name:      "fixed amount never exceeds the eligible lines",
+			coupon:    Coupon{Code: "BIG", Type: CouponFixedAmount, AmountOff: usd(5000)},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 1}, {id: "b", price: 500, quantity: 2}},
+			discounts: []int64{1000, 1000},
+			total:     0,
+		},
+		{
+			name:      "minimum order value reached",
+			coupon:    Coupon{Code: "TEN", Type: CouponPercentage, PercentOff: 10, MinOrderValue: usd(2000)},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 2}},
+			discounts: []int64{200},
+			total:     1800,
+		},
+		{
+			name:      "minimum order value not reached",
+			coupon:    Coupon{Code: "TEN", Type: CouponPercentage, PercentOff: 10, MinOrderValue: usd(2001)},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 2}},
+			discounts: []int64{0},
+			total:     2000,
+			err:       ErrCouponNotApplicable,
+		},
+		{
+			name: "minimum order value in another currency",
+			coupon: Coupon{Code: "EURO", Type: CouponPercentage, PercentOff: 10,
+				MinOrderValue: &common.Money{Amount: 100, Currency: "EUR"}},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 1}},
+			discounts: []int64{0},
+			total:     1000,
+			err:       common.ErrCurrencyMismatch,
+		},
+		{
+			name: "category restriction",
+			coupon: Coupon{Code: "SHOES", Type: CouponPercentage, PercentOff: 50,
+				Restrictions: []CouponRestriction{{Kind: RestrictCategory, RefID: "shoes"}}},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 1, category: "shoes"}, {id: "b", price: 1000, quantity: 1, category: "hats"}},
+			discounts: []int64{500, 0},
+			total:     1500,
+		},
+		{
+			name: "product restriction matches the catalog product",
+			coupon: Coupon{Code: "BOOT", Type: CouponFixedAmount, AmountOff: usd(300),
+				Restrictions: []CouponRestriction{{Kind: RestrictProduct, RefID: "boot"}}},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 1, parent: "boot"}, {id: "b", price: 1000, quantity: 1, parent: "sock"}},
+			discounts: []int64{300, 0},
+			total:     1700,
+		},
+		{
+			name: "product restriction matches the ordered variant",
+			coupon: Coupon{Code: "VARIANT", Type: CouponPercentage, PercentOff: 10,
+				Restrictions: []CouponRestriction{{Kind: RestrictProduct, RefID: "variant-b"}}},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 1}, {id: "b", price: 2000, quantity: 1}},
+			discounts: []int64{0, 200},
+			total:     2800,
+		},
+		{
+			name: "no eligible item",
+			coupon: Coupon{Code: "SHOES", Type: CouponPercentage, PercentOff: 50,
+				Restrictions: []CouponRestriction{{Kind: RestrictCategory, RefID: "shoes"}}},
+			lines:     []testLine{{id: "a", price: 1000, quantity: 1, category: "hats"}, {id: "b", price: 1000, quantity: 1}},
+			discounts: []int64{0, 0},
+			total:     2000,
+			err:       ErrCouponNotApplicable,
+		},
+	}
+	for _, tt := range tests {
+		order := pricedOrder(tt.lines...)
+		err := order.ApplyCoupon(&tt.coupon)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: ApplyCoupon error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+
+		var discounted int64
+		for i, item := range order.OrderItems {
+			if item.Discount.Amount != tt.discounts[i] || item.Discount.Currency != "USD" {
+				t.Errorf("%s: discount of line %s = %s, want %d cents", tt.name, item.ID, item.Discount, tt.discounts[i])
+			}
+			discounted += item.Discount.Amount
+		}
+		if order.DiscountTotal.Amount != discounted {
+			t.Errorf("%s: discount total %s does not add up the line discounts %d", tt.name, order.DiscountTotal, discounted)
+		}
+		if order.TotalAmount.Amount != tt.total || order.TotalAmount.Currency != "USD" {
+			t.Errorf("%s: total = %s, want %d cents", tt.name, order.TotalAmount, tt.total)
+		}
+		if order.CouponCode != tt.coupon.Code {
+			t.Errorf("%s: coupon code = %q, want %q", tt.name, order.CouponCode, tt.coupon.Code)
+		}
+	}
+}
+
+// TestApplyCouponTwice checks that applying a coupon again starts over instead of adding discounts up
+func TestApplyCouponTwice(t *testing.T) {
+	order := pricedOrder(testLine{id: "a", price: 1000, quantity: 1})
+	coupon := Coupon{Code: "TEN", Type: CouponPercentage, PercentOff: 10}
+	for i := 0; i < 2; i++ {
+		if err := order.ApplyCoupon(&coupon); err != nil {
+			t.Fatalf("ApplyCoupon: %v", err)
+		}
+	}
+	if order.DiscountTotal.Amount != 100 || order.TotalAmount.Amount != 900 {
+		t.Errorf("discount %s and total %s, want 1.00 and 9.00", order.DiscountTotal, order.TotalAmount)
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrIdempotencyKeyReused is returned when a key comes back with a different request than it was first used for
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+// IdempotencyKey remembers the response to a request sent with an Idempotency-Key header, so a retry within
+// the TTL gets the same response instead of repeating the request. Keys are scoped per user
+type IdempotencyKey struct {
+	UserID      string    `gorm:"primaryKey;type:varchar(64)"`
+	Key         string    `gorm:"primaryKey;type:varchar(255)"`
+	RequestHash string    `gorm:"type:char(64);not null"` // SHA-256 of the request, hex encoded
+	OrderID     string    `gorm:"type:uuid;not null"`
+	StatusCode  int       `gorm:"not null"`
+	Response    []byte    `gorm:"type:jsonb;not null"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// Matches reports whether the request hash is the one the key was first used with
+func (k *IdempotencyKey) Matches(requestHash string) bool {
+	return k.RequestHash == requestHash
+}
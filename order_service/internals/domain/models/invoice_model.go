@@ -0,0 +1,120 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+// ErrInvoiceNotAllowed is returned when an invoice is asked for an order that was never confirmed
+var ErrInvoiceNotAllowed = errors.New("order cannot be invoiced")
+
+// Invoices Model, issued once per order when it is confirmed or paid. Invoices are never changed after they
+// were issued, numbers run without gaps within a calendar year
+type Invoice struct {
+	ID              string          `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID         string          `gorm:"type:uuid;not null;uniqueIndex"`
+	Number          string          `gorm:"type:varchar(32);not null;uniqueIndex"` // INV-2026-000042
+	Year            int             `gorm:"not null;uniqueIndex:idx_invoice_sequence"`
+	Sequence        int64           `gorm:"not null;uniqueIndex:idx_invoice_sequence"`
+	IssuedAt        time.Time       `gorm:"not null"`
+	Currency        string          `gorm:"type:char(3);not null"`
+	BuyerID         string          `gorm:"not null;index"`
+	BuyerName       string          `gorm:"type:varchar(255)"`
+	BuyerEmail      string          `gorm:"type:varchar(255)"`
+	BuyerPhone      string          `gorm:"type:varchar(32)"`
+	ShippingAddress ShippingAddress `gorm:"embedded;embeddedPrefix:shipping_"`
+	CouponCode      string          `gorm:"type:varchar(64)"`
+	Subtotal        common.Money    `gorm:"embedded;embeddedPrefix:subtotal_"`
+	DiscountTotal   common.Money    `gorm:"embedded;embeddedPrefix:discount_total_"`
+	TaxTotal        common.Money    `gorm:"embedded;embeddedPrefix:tax_total_"`
+	Total           common.Money    `gorm:"embedded;embeddedPrefix:total_"`
+	Lines           []InvoiceLine   `gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE;"`
+}
+
+// InvoiceLines Model, one ordered item of an invoice
+type InvoiceLine struct {
+	ID             string       `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	InvoiceID      string       `gorm:"not null;index"`
+	Position       int          `gorm:"not null"` // 1 based, in the order of the order items
+	ProductID      string       `gorm:"not null"`
+	Quantity       int          `gorm:"not null"`
+	UnitPrice      common.Money `gorm:"embedded;embeddedPrefix:unit_price_"`
+	Discount       common.Money `gorm:"embedded;embeddedPrefix:discount_"`
+	TaxBasisPoints int          `gorm:"not null"`
+	Tax            common.Money `gorm:"embedded;embeddedPrefix:tax_"`
+	Total          common.Money `gorm:"embedded;embeddedPrefix:total_"` // Line after discount with tax
+}
+
+// InvoiceSequences Model, the last invoice number handed out in a year. The row is locked until the
+// invoice that took the number is stored, so a failed issue gives its number back
+type InvoiceSequence struct {
+	Year       int   `gorm:"primaryKey;autoIncrement:false"`
+	LastNumber int64 `gorm:"not null"`
+}
+
+// Buyer is who the invoice is made out to, as the user service knows them when the invoice is issued
+type Buyer struct {
+	UserID string
+	Name   string
+	Email  string
+	Phone  string
+}
+
+// CanBeInvoiced reports whether the order went through confirmation, the point its prices and tax are final
+func (o *Order) CanBeInvoiced() bool {
+	switch o.Status {
+	case OrderConfirmed, OrderPaid, OrderShipped, OrderDelivered:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewInvoice builds the invoice of a confirmed order for the buyer. The number is assigned when it is stored
+func (o *Order) NewInvoice(buyer Buyer, issuedAt time.Time) (*Invoice, error) {
+	if !o.CanBeInvoiced() {
+		return nil, fmt.Errorf("%w: order is %s", ErrInvoiceNotAllowed, o.Status)
+	}
+
+	invoice := &Invoice{
+		OrderID:         o.OrderID,
+		Year:            issuedAt.UTC().Year(),
+		IssuedAt:        issuedAt,
+		Currency:        o.TotalAmount.Currency,
+		BuyerID:         buyer.UserID,
+		BuyerName:       strings.TrimSpace(buyer.Name),
+		BuyerEmail:      buyer.Email,
+		BuyerPhone:      buyer.Phone,
+		ShippingAddress: o.ShippingAddress,
+		CouponCode:      o.CouponCode,
+		Subtotal:        o.Subtotal,
+		DiscountTotal:   o.DiscountTotal,
+		TaxTotal:        o.TaxTotal,
+		Total:           o.TotalAmount,
+		Lines:           make([]InvoiceLine, 0, len(o.OrderItems)),
+	}
+	for i := range o.OrderItems {
+		item := &o.OrderItems[i]
+		invoice.Lines = append(invoice.Lines, InvoiceLine{
+			Position:       i + 1,
+			ProductID:      item.ProductID,
+			Quantity:       item.Quantity,
+			UnitPrice:      item.Price,
+			Discount:       item.Discount,
+			TaxBasisPoints: item.TaxBasisPoints,
+			Tax:            item.Tax,
+			Total:          item.Amount(item.Quantity),
+		})
+	}
+	return invoice, nil
+}
+
+// AssignNumber gives the invoice the sequence number it took in its year
+func (i *Invoice) AssignNumber(sequence int64) {
+	i.Sequence = sequence
+	i.Number = fmt.Sprintf("INV-%d-%06d", i.Year, sequence)
+}
@@ -1,32 +1,191 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/palashbhasme/ecommerce_microservices/common"
 	"gorm.io/gorm"
 )
 
 // Orders Model
 type Order struct {
-	OrderID    string      `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"` // UUID as Primary Key
-	UserID     string      `gorm:"index"`                                          // Index for faster queries
-	Quantity   int         `gorm:"not null"`
-	Status     OrderStatus `gorm:"type:varchar(20);not null"`
-	CreatedAt  time.Time   `gorm:"autoCreateTime"`
-	UpdatedAt  time.Time   `gorm:"autoUpdateTime"`
-	OrderItems []OrderItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE;"` // Relationship with OrderItems
+	OrderID         string          `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"` // UUID as Primary Key
+	UserID          string          `gorm:"index"`                                          // Index for faster queries
+	Quantity        int             `gorm:"not null"`
+	Status          OrderStatus     `gorm:"type:varchar(20);not null"`
+	Currency        string          `gorm:"type:char(3);not null;default:'USD'"`     // Locked in at creation, all amounts are in it
+	TotalAmount     common.Money    `gorm:"embedded;embeddedPrefix:total_amount_"`   // Amount to pay with discounts and tax, set once inventory confirmed the order
+	Subtotal        common.Money    `gorm:"embedded;embeddedPrefix:subtotal_"`       // Catalog total before discounts
+	DiscountTotal   common.Money    `gorm:"embedded;embeddedPrefix:discount_total_"` // Sum of the item discounts
+	TaxTotal        common.Money    `gorm:"embedded;embeddedPrefix:tax_total_"`      // Sum of the item taxes
+	CouponCode      string          `gorm:"type:varchar(64);index"`                  // Coupon the order was placed with, upper case
+	PriceMismatch   bool            `gorm:"default:false"`                           // A quoted item price differed from the catalog
+	ShippingAddress ShippingAddress `gorm:"embedded;embeddedPrefix:shipping_"`
+	CreatedAt       time.Time       `gorm:"autoCreateTime"`
+	UpdatedAt       time.Time       `gorm:"autoUpdateTime"`
+	OrderItems      []OrderItem     `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE;"` // Relationship with OrderItems
+	Refunds         []Refund        `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE;"`
+	Returns         []ReturnRequest `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE;"`
+	Shipments       []Shipment      `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE;"`
+}
+
+// ShippingAddress is a copy of the user address the order ships to, taken when the order is created so
+// later changes to the user profile do not rewrite where past orders went. Columns are only written on create
+type ShippingAddress struct {
+	AddressID string `gorm:"<-:create;type:varchar(64)"` // Id of the address in the user service
+	Line1     string `gorm:"<-:create"`
+	Line2     string `gorm:"<-:create"`
+	City      string `gorm:"<-:create"`
+	State     string `gorm:"<-:create"`
+	Country   string `gorm:"<-:create"`
+	ZipCode   string `gorm:"<-:create;type:varchar(20)"`
+}
+
+// IsCountryCode reports whether the code has the shape of an ISO 3166-1 alpha-2 code, two upper case letters.
+// The user service checks addresses against the list of assigned codes
+func IsCountryCode(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
 }
 
 // OrderItems Model
 type OrderItem struct {
-	ID        string  `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	OrderID   string  `gorm:"not null;index"`
-	ProductID string  `gorm:"not null"`
-	Price     float64 `gorm:"not null"` // Changed from int to float for better precision
-	Quantity  int     `gorm:"not null"`
+	ID             string        `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID        string        `gorm:"not null;index"`
+	ProductID      string        `gorm:"not null"`
+	Price          common.Money  `gorm:"embedded;embeddedPrefix:price_"`
+	QuotedPrice    *common.Money `gorm:"embedded;embeddedPrefix:quoted_price_"` // Price the client sent, kept to explain a price mismatch
+	Quantity       int           `gorm:"not null"`
+	Discount       common.Money  `gorm:"embedded;embeddedPrefix:discount_"` // Coupon discount on the whole line
+	Tax            common.Money  `gorm:"embedded;embeddedPrefix:tax_"`      // Tax on the discounted line
+	TaxBasisPoints int           `gorm:"not null;default:0"`                // Rate the tax was charged at, 825 is 8.25%
+	// Catalog product and category of the variant, reported by inventory with the prices
+	ParentProductID string `gorm:"type:varchar(64)"`
+	CategoryID      string `gorm:"type:varchar(64)"`
+}
+
+// Amount is what the given quantity of the item costs with its share of the line discount and tax
+func (i *OrderItem) Amount(quantity int) common.Money {
+	amount := i.Price.Mul(int64(quantity))
+	if i.Quantity == 0 {
+		return amount
+	}
+	amount.Amount += (i.Tax.Amount - i.Discount.Amount) * int64(quantity) / int64(i.Quantity)
+	return amount
+}
+
+// NetAmount is the line total after the discount, the amount tax is charged on
+func (i *OrderItem) NetAmount() common.Money {
+	amount := i.Price.Mul(int64(i.Quantity))
+	amount.Amount -= i.Discount.Amount
+	return amount
+}
+
+// OrderPricing holds the catalog prices inventory reported for an order
+type OrderPricing struct {
+	TotalAmount common.Money
+	Items       map[string]PricedVariant // Keyed by the ordered product variant id
+}
+
+// PricedVariant is the catalog price of an ordered variant and where it sits in the catalog
+type PricedVariant struct {
+	UnitPrice       common.Money
+	ParentProductID string
+	CategoryID      string
+}
+
+// ApplyPricing overwrites item prices with the catalog prices and flags the order when a quoted price
+// does not match. Items the pricing does not cover keep their price.
+// Prices in another currency than the order currency are refused with common.ErrCurrencyMismatch
+func (o *Order) ApplyPricing(pricing OrderPricing) error {
+	if err := o.checkCurrency(pricing.TotalAmount); err != nil {
+		return err
+	}
+	for _, priced := range pricing.Items {
+		if err := o.checkCurrency(priced.UnitPrice); err != nil {
+			return err
+		}
+	}
+
+	for i := range o.OrderItems {
+		item := &o.OrderItems[i]
+		priced, ok := pricing.Items[item.ProductID]
+		if !ok {
+			continue
+		}
+		if item.QuotedPrice != nil && !item.QuotedPrice.Equal(priced.UnitPrice) {
+			o.PriceMismatch = true
+		}
+		item.Price = priced.UnitPrice
+		item.ParentProductID = priced.ParentProductID
+		item.CategoryID = priced.CategoryID
+	}
+	o.Subtotal = pricing.TotalAmount
+	o.TotalAmount = pricing.TotalAmount
+	return nil
+}
+
+func (o *Order) checkCurrency(amount common.Money) error {
+	currency := o.Currency
+	if currency == "" {
+		currency = common.DefaultCurrency
+	}
+	if amount.Currency != currency {
+		return fmt.Errorf("%w: order is in %s, got %s", common.ErrCurrencyMismatch, currency, amount.Currency)
+	}
+	return nil
+}
+
+// OrderStatusEvents Model, one row per status change of an order
+type OrderStatusEvent struct {
+	ID         string      `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID    string      `gorm:"not null;index"`
+	FromStatus OrderStatus `gorm:"type:varchar(20);not null"`
+	ToStatus   OrderStatus `gorm:"type:varchar(20);not null"`
+	Actor      string      `gorm:"type:varchar(255);not null"` // User email or the service that caused the change
+	Reason     string      `gorm:"type:text"`
+	MessageID  string      `gorm:"type:varchar(255)"` // Set when the change came in over rabbitmq
+	CreatedAt  time.Time   `gorm:"autoCreateTime;index"`
+}
+
+// StatusChange describes who asked for a status transition and why, it ends up in the order history
+type StatusChange struct {
+	Actor     string
+	Reason    string
+	MessageID string
+	Consumer  string // Set by rabbitmq consumers so the message id is recorded in the inbox with the change
+}
+
+// OrderQuery selects a page of orders, zero fields do not filter
+type OrderQuery struct {
+	UserID    string
+	Statuses  []OrderStatus
+	From      time.Time // Created at or after
+	To        time.Time // Created before
+	ProductID string    // Orders containing the product variant
+	SortBy    string    // A key of OrderSortColumns, defaults to created_at
+	Ascending bool
+	Page      int // Starts at 1
+	PageSize  int
+}
+
+// OrderSortColumns maps the keys orders can be sorted by to their columns. Totals sort by their minor units
+var OrderSortColumns = map[string]string{
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+	"status":       "status",
+	"quantity":     "quantity",
+	"total_amount": "total_amount_minor",
 }
 
 func AutoMigrate(db *gorm.DB) error {
-	err := db.AutoMigrate(Order{}, OrderItem{})
-	return err
+	err := db.AutoMigrate(Order{}, OrderItem{}, OrderStatusEvent{}, OutboxMessage{}, Cart{}, CartItem{}, PaymentAttempt{}, Refund{}, RefundItem{}, ReturnRequest{}, ReturnItem{}, Shipment{}, ShipmentItem{}, IdempotencyKey{}, Coupon{}, CouponRestriction{}, CouponRedemption{}, TaxRate{}, Invoice{}, InvoiceLine{}, InvoiceSequence{})
+	if err != nil {
+		return err
+	}
+	// Item prices were floats before money was stored in minor units
+	if err := common.MigrateMoneyColumns(db, "order_items", "price"); err != nil {
+		return err
+	}
+	return common.MigrateInbox(db)
 }
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// OutboxMessage is an event waiting to be published to rabbitmq. It is written in the same
+// transaction as the change it announces and picked up by the outbox relay afterwards
+type OutboxMessage struct {
+	ID            string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"` // Also used as the AMQP message id
+	Exchange      string     `gorm:"type:varchar(100);not null"`
+	RoutingKey    string     `gorm:"type:varchar(100);not null"`
+	Payload       []byte     `gorm:"type:jsonb;not null"`
+	Attempts      int        `gorm:"default:0"`
+	LastError     string     `gorm:"type:text"`
+	NextAttemptAt time.Time  `gorm:"not null;index"`
+	SentAt        *time.Time `gorm:"index"` // Nil until the relay published the message
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentSucceeded PaymentStatus = "succeeded"
+	PaymentDeclined  PaymentStatus = "declined"
+)
+
+// PaymentAttempts Model, one row per charge sent to the payment gateway for an order
+type PaymentAttempt struct {
+	ID            string        `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID       string        `gorm:"not null;index"`
+	Amount        common.Money  `gorm:"embedded;embeddedPrefix:amount_"`
+	Provider      string        `gorm:"type:varchar(50);not null"`  // Name of the gateway that ran the charge
+	ProviderRef   string        `gorm:"type:varchar(255);not null"` // Charge id at the provider
+	Status        PaymentStatus `gorm:"type:varchar(20);not null"`
+	FailureReason string        `gorm:"type:text"`
+	MessageID     string        `gorm:"type:varchar(255)"` // Payment request that caused the attempt, also the idempotency key
+	CreatedAt     time.Time     `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+type RefundStatus string
+
+const (
+	RefundRequested RefundStatus = "requested"
+	RefundProcessed RefundStatus = "processed"
+	RefundFailed    RefundStatus = "failed"
+)
+
+var (
+	// ErrRefundNotAllowed is returned for orders that were never paid or are still on their way
+	ErrRefundNotAllowed = errors.New("order cannot be refunded")
+	// ErrInvalidRefund is returned when a refund asks for more than is left to refund
+	ErrInvalidRefund = errors.New("invalid refund")
+)
+
+// Refunds Model, money paid for an order that is given back in full or for some of its items
+type Refund struct {
+	ID            string       `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID       string       `gorm:"not null;index"`
+	Amount        common.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	Reason        string       `gorm:"type:text;not null"`
+	Status        RefundStatus `gorm:"type:varchar(20);not null"`
+	Restock       bool         `gorm:"default:false"`              // Refunded items go back to inventory
+	RequestedBy   string       `gorm:"type:varchar(255);not null"` // Admin that asked for the refund
+	PaymentRef    string       `gorm:"type:varchar(255);not null"` // Provider reference of the charge being refunded
+	ProviderRef   string       `gorm:"type:varchar(255)"`          // Refund id at the provider once processed
+	FailureReason string       `gorm:"type:text"`
+	CreatedAt     time.Time    `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time    `gorm:"autoUpdateTime"`
+	Items         []RefundItem `gorm:"foreignKey:RefundID;constraint:OnDelete:CASCADE;"` // Empty for full refunds of an order without items left
+}
+
+// RefundItems Model, the quantity of an order item a refund covers
+type RefundItem struct {
+	ID          string       `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	RefundID    string       `gorm:"not null;index"`
+	OrderItemID string       `gorm:"not null;index"`
+	ProductID   string       `gorm:"not null"`
+	Quantity    int          `gorm:"not null"`
+	Amount      common.Money `gorm:"embedded;embeddedPrefix:amount_"`
+}
+
+// RefundLine asks to refund a quantity of one order item
+type RefundLine struct {
+	OrderItemID string
+	Quantity    int
+}
+
+// IsRefundable reports whether money paid for an order in this status may be given back
+func (s OrderStatus) IsRefundable() bool {
+	return s == OrderDelivered || s == OrderCancelled
+}
+
+// NewRefund checks a refund against what was captured and what earlier refunds already gave back.
+// Without lines everything left is refunded. Failed refunds do not count. Restocking is refused for quantities
+// that already went back on stock, through an earlier refund or a received return
+func (o *Order) NewRefund(id string, captured common.Money, lines []RefundLine, reason, actor string, restock bool) (*Refund, error) {
+	if !o.Status.IsRefundable() {
+		return nil, fmt.Errorf("%w: order is %s", ErrRefundNotAllowed, o.Status)
+	}
+	// Stock of cancelled orders was already released back to inventory
+	if restock && o.Status == OrderCancelled {
+		return nil, fmt.Errorf("%w: stock of cancelled orders is already released", ErrInvalidRefund)
+	}
+
+	remaining := captured
+	refundedQuantity := make(map[string]int)
+	restockedQuantity := make(map[string]int)
+	for _, refund := range o.Refunds {
+		if refund.Status == RefundFailed {
+			continue
+		}
+		var err error
+		if remaining, err = remaining.Sub(refund.Amount); err != nil {
+			return nil, err
+		}
+		for _, item := range refund.Items {
+			refundedQuantity[item.OrderItemID] += item.Quantity
+			if refund.Restock {
+				restockedQuantity[item.OrderItemID] += item.Quantity
+			}
+		}
+	}
+	for _, ret := range o.Returns {
+		if ret.Status != ReturnReceived {
+			continue
+		}
+		for _, item := range ret.Items {
+			if item.Restockable {
+				restockedQuantity[item.OrderItemID] += item.Quantity
+			}
+		}
+	}
+	if remaining.IsZero() || remaining.IsNegative() {
+		return nil, fmt.Errorf("%w: order is already fully refunded", ErrInvalidRefund)
+	}
+
+	refund := &Refund{
+		ID:          id,
+		OrderID:     o.OrderID,
+		Reason:      reason,
+		Status:      RefundRequested,
+		Restock:     restock,
+		RequestedBy: actor,
+	}
+
+	full := len(lines) == 0
+	if full {
+		for _, item := range o.OrderItems {
+			lines = append(lines, RefundLine{OrderItemID: item.ID, Quantity: item.Quantity - refundedQuantity[item.ID]})
+		}
+	}
+
+	amount := common.Zero(captured.Currency)
+	for _, line := range lines {
+		if line.Quantity == 0 && full {
+			continue
+		}
+		item := o.item(line.OrderItemID)
+		if item == nil {
+			return nil, fmt.Errorf("%w: order has no item %s", ErrInvalidRefund, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || refundedQuantity[item.ID]+line.Quantity > item.Quantity {
+			return nil, fmt.Errorf("%w: only %d of item %s left to refund", ErrInvalidRefund, item.Quantity-refundedQuantity[item.ID], item.ID)
+		}
+		refundedQuantity[item.ID] += line.Quantity
+		if restock && restockedQuantity[item.ID]+line.Quantity > item.Quantity {
+			return nil, fmt.Errorf("%w: %d of item %s are already back on stock, refund them without restock",
+				ErrInvalidRefund, restockedQuantity[item.ID], item.ID)
+		}
+		if restock {
+			restockedQuantity[item.ID] += line.Quantity
+		}
+
+		lineAmount := item.Amount(line.Quantity)
+		refund.Items = append(refund.Items, RefundItem{
+			OrderItemID: item.ID,
+			ProductID:   item.ProductID,
+			Quantity:    line.Quantity,
+			Amount:      lineAmount,
+		})
+		var err error
+		if amount, err = amount.Add(lineAmount); err != nil {
+			return nil, err
+		}
+	}
+
+	// A full refund gives back whatever is left of the charge, not just the item prices
+	if full {
+		amount = remaining
+	}
+	if cmp, err := amount.Cmp(remaining); err != nil {
+		return nil, err
+	} else if cmp > 0 {
+		return nil, fmt.Errorf("%w: %s exceeds the %s left to refund", ErrInvalidRefund, amount, remaining)
+	}
+	if amount.IsZero() {
+		return nil, fmt.Errorf("%w: nothing to refund", ErrInvalidRefund)
+	}
+	refund.Amount = amount
+	return refund, nil
+}
+
+func (o *Order) item(id string) *OrderItem {
+	for i := range o.OrderItems {
+		if o.OrderItems[i].ID == id {
+			return &o.OrderItems[i]
+		}
+	}
+	return nil
+}
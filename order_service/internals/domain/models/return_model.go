@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ReturnStatus string
+
+const (
+	ReturnRequested ReturnStatus = "requested"
+	ReturnApproved  ReturnStatus = "approved"
+	ReturnRejected  ReturnStatus = "rejected"
+	ReturnReceived  ReturnStatus = "received"
+)
+
+var (
+	// ErrReturnNotAllowed is returned for returns against orders that were not delivered
+	ErrReturnNotAllowed = errors.New("order cannot be returned")
+	// ErrInvalidReturn is returned when a return asks for items or quantities the order does not have
+	ErrInvalidReturn = errors.New("invalid return")
+)
+
+// returnTransitions lists the statuses each return status may move to
+var returnTransitions = map[ReturnStatus][]ReturnStatus{
+	ReturnRequested: {ReturnApproved, ReturnRejected},
+	ReturnApproved:  {ReturnReceived},
+}
+
+// CanTransitionTo reports whether a return may move from this status to next
+func (s ReturnStatus) CanTransitionTo(next ReturnStatus) bool {
+	for _, allowed := range returnTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ReturnRequests Model, a customer sending back delivered items
+type ReturnRequest struct {
+	ID             string       `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID        string       `gorm:"not null;index"`
+	Status         ReturnStatus `gorm:"type:varchar(20);not null"`
+	RequestedBy    string       `gorm:"type:varchar(255);not null"`
+	ReviewedBy     string       `gorm:"type:varchar(255)"` // Admin that approved or rejected the return
+	ResolutionNote string       `gorm:"type:text"`
+	ReceivedAt     *time.Time
+	CreatedAt      time.Time    `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time    `gorm:"autoUpdateTime"`
+	Items          []ReturnItem `gorm:"foreignKey:ReturnID;constraint:OnDelete:CASCADE;"`
+}
+
+// ReturnItems Model, the quantity of an order item being sent back
+type ReturnItem struct {
+	ID          string `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ReturnID    string `gorm:"not null;index"`
+	OrderItemID string `gorm:"not null;index"`
+	ProductID   string `gorm:"not null"`
+	Quantity    int    `gorm:"not null"`
+	Reason      string `gorm:"type:text;not null"`
+	Restockable bool   `gorm:"default:true"` // Set on receipt, damaged items do not go back on stock
+}
+
+// ReturnLine asks to return a quantity of one order item
+type ReturnLine struct {
+	OrderItemID string
+	Quantity    int
+	Reason      string
+}
+
+// NewReturn checks a return against the delivered items and what earlier returns already cover.
+// Rejected returns do not count
+func (o *Order) NewReturn(id string, lines []ReturnLine, actor string) (*ReturnRequest, error) {
+	if o.Status != OrderDelivered {
+		return nil, fmt.Errorf("%w: order is %s", ErrReturnNotAllowed, o.Status)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: no items", ErrInvalidReturn)
+	}
+
+	returnedQuantity := make(map[string]int)
+	for _, ret := range o.Returns {
+		if ret.Status == ReturnRejected {
+			continue
+		}
+		for _, item := range ret.Items {
+			returnedQuantity[item.OrderItemID] += item.Quantity
+		}
+	}
+
+	ret := &ReturnRequest{
+		ID:          id,
+		OrderID:     o.OrderID,
+		Status:      ReturnRequested,
+		RequestedBy: actor,
+	}
+	for _, line := range lines {
+		item := o.item(line.OrderItemID)
+		if item == nil {
+			return nil, fmt.Errorf("%w: order has no item %s", ErrInvalidReturn, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || returnedQuantity[item.ID]+line.Quantity > item.Quantity {
+			return nil, fmt.Errorf("%w: only %d of item %s left to return", ErrInvalidReturn, item.Quantity-returnedQuantity[item.ID], item.ID)
+		}
+		returnedQuantity[item.ID] += line.Quantity
+
+		ret.Items = append(ret.Items, ReturnItem{
+			OrderItemID: item.ID,
+			ProductID:   item.ProductID,
+			Quantity:    line.Quantity,
+			Reason:      line.Reason,
+			Restockable: true,
+		})
+	}
+	return ret, nil
+}
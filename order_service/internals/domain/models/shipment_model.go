@@ -0,0 +1,124 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ShipmentStatus string
+
+const (
+	ShipmentInTransit ShipmentStatus = "in_transit"
+	ShipmentDelivered ShipmentStatus = "delivered"
+)
+
+var (
+	// ErrShipmentNotAllowed is returned for shipments of orders that are not paid
+	ErrShipmentNotAllowed = errors.New("order cannot be shipped")
+	// ErrInvalidShipment is returned when a shipment holds items or quantities that are not left to ship
+	ErrInvalidShipment = errors.New("invalid shipment")
+)
+
+// Shipments Model, a parcel handed to a carrier. An order can be split over several shipments
+type Shipment struct {
+	ID             string         `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OrderID        string         `gorm:"not null;index"`
+	Carrier        string         `gorm:"type:varchar(100);not null"`
+	TrackingNumber string         `gorm:"type:varchar(255);not null"`
+	Status         ShipmentStatus `gorm:"type:varchar(20);not null"`
+	CreatedBy      string         `gorm:"type:varchar(255);not null"`
+	ShippedAt      time.Time      `gorm:"not null"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime"`
+	Items          []ShipmentItem `gorm:"foreignKey:ShipmentID;constraint:OnDelete:CASCADE;"`
+}
+
+// ShipmentItems Model, the quantity of an order item in a shipment
+type ShipmentItem struct {
+	ID          string `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ShipmentID  string `gorm:"not null;index"`
+	OrderItemID string `gorm:"not null;index"`
+	ProductID   string `gorm:"not null"`
+	Quantity    int    `gorm:"not null"`
+}
+
+// ShipmentLine puts a quantity of one order item into a shipment
+type ShipmentLine struct {
+	OrderItemID string
+	Quantity    int
+}
+
+// NewShipment checks a shipment against what earlier shipments already sent. Without lines everything
+// left to ship goes into the shipment
+func (o *Order) NewShipment(id string, lines []ShipmentLine, carrier, trackingNumber, actor string) (*Shipment, error) {
+	if o.Status != OrderPaid && o.Status != OrderShipped {
+		return nil, fmt.Errorf("%w: order is %s", ErrShipmentNotAllowed, o.Status)
+	}
+
+	shipped := o.shippedQuantities()
+	if len(lines) == 0 {
+		for _, item := range o.OrderItems {
+			if left := item.Quantity - shipped[item.ID]; left > 0 {
+				lines = append(lines, ShipmentLine{OrderItemID: item.ID, Quantity: left})
+			}
+		}
+		if len(lines) == 0 {
+			return nil, fmt.Errorf("%w: every item was already shipped", ErrInvalidShipment)
+		}
+	}
+
+	shipment := &Shipment{
+		ID:             id,
+		OrderID:        o.OrderID,
+		Carrier:        carrier,
+		TrackingNumber: trackingNumber,
+		Status:         ShipmentInTransit,
+		CreatedBy:      actor,
+		ShippedAt:      time.Now(),
+	}
+	for _, line := range lines {
+		item := o.item(line.OrderItemID)
+		if item == nil {
+			return nil, fmt.Errorf("%w: order has no item %s", ErrInvalidShipment, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || shipped[item.ID]+line.Quantity > item.Quantity {
+			return nil, fmt.Errorf("%w: only %d of item %s left to ship", ErrInvalidShipment, item.Quantity-shipped[item.ID], item.ID)
+		}
+		shipped[item.ID] += line.Quantity
+
+		shipment.Items = append(shipment.Items, ShipmentItem{
+			OrderItemID: item.ID,
+			ProductID:   item.ProductID,
+			Quantity:    line.Quantity,
+		})
+	}
+	return shipment, nil
+}
+
+// FullyDelivered reports whether every item was shipped and every shipment arrived
+func (o *Order) FullyDelivered() bool {
+	shipped := o.shippedQuantities()
+	for _, item := range o.OrderItems {
+		if shipped[item.ID] < item.Quantity {
+			return false
+		}
+	}
+	for _, shipment := range o.Shipments {
+		if shipment.Status != ShipmentDelivered {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *Order) shippedQuantities() map[string]int {
+	shipped := make(map[string]int)
+	for _, shipment := range o.Shipments {
+		for _, item := range shipment.Items {
+			shipped[item.OrderItemID] += item.Quantity
+		}
+	}
+	return shipped
+}
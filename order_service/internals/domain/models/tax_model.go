@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+// TaxRates Model, the rate charged on items shipped to a country, optionally narrowed to a state and
+// a product category. Empty state or category match everything
+type TaxRate struct {
+	ID          string    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Country     string    `gorm:"type:varchar(2);not null;uniqueIndex:idx_tax_rate_scope"` // ISO 3166-1 alpha-2, upper case
+	State       string    `gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_tax_rate_scope"`
+	CategoryID  string    `gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_tax_rate_scope"` // Inventory category id
+	BasisPoints int       `gorm:"not null"`                                                            // 825 is 8.25%
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+}
+
+// LineTax is the tax charged on one order item
+type LineTax struct {
+	OrderItemID string
+	BasisPoints int
+	Tax         common.Money
+}
+
+// ApplyTax stores the tax of every item on the order and adds it to the amount to pay.
+// Items without a line are not taxed
+func (o *Order) ApplyTax(lines []LineTax) error {
+	taxes := make(map[string]LineTax, len(lines))
+	for _, line := range lines {
+		if err := o.checkCurrency(line.Tax); err != nil {
+			return err
+		}
+		taxes[line.OrderItemID] = line
+	}
+
+	currency := o.Subtotal.Currency
+	o.TaxTotal = common.Zero(currency)
+	for i := range o.OrderItems {
+		item := &o.OrderItems[i]
+		line, ok := taxes[item.ID]
+		if !ok {
+			item.Tax = common.Zero(currency)
+			item.TaxBasisPoints = 0
+			continue
+		}
+		item.Tax = line.Tax
+		item.TaxBasisPoints = line.BasisPoints
+		o.TaxTotal.Amount += line.Tax.Amount
+	}
+
+	o.TotalAmount = common.NewMoney(o.Subtotal.Amount-o.DiscountTotal.Amount+o.TaxTotal.Amount, currency)
+	return nil
+}
@@ -9,11 +9,14 @@ import (
 type OrderStatus string
 
 const (
-	OrderPending   OrderStatus = "pending"
-	OrderShipped   OrderStatus = "shipped"
-	OrderConfirmed OrderStatus = "confirmed"
-	OrderCancelled OrderStatus = "cancelled"
-	OrderDelivered OrderStatus = "delivered"
+	OrderPending       OrderStatus = "pending"
+	OrderShipped       OrderStatus = "shipped"
+	OrderConfirmed     OrderStatus = "confirmed"
+	OrderCancelled     OrderStatus = "cancelled"
+	OrderDelivered     OrderStatus = "delivered"
+	OrderPaid          OrderStatus = "paid"
+	OrderPaymentFailed OrderStatus = "payment_failed"
+	OrderFailed        OrderStatus = "failed" // Confirmed by inventory but the order cannot be priced or taxed
 )
 
 // takes in order status
@@ -23,13 +26,11 @@ func (s *OrderStatus) Scan(value interface{}) error {
 		return fmt.Errorf("error invalid data for order status")
 	}
 
-	switch OrderStatus(v) {
-	case OrderPending, OrderShipped, OrderConfirmed, OrderCancelled, OrderDelivered:
-		*s = OrderStatus(v)
-		return nil
-	default:
+	if !OrderStatus(v).IsValid() {
 		return errors.New("invalid order status value")
 	}
+	*s = OrderStatus(v)
+	return nil
 
 }
 
@@ -37,3 +38,50 @@ func (s *OrderStatus) Scan(value interface{}) error {
 func (s OrderStatus) Value() (driver.Value, error) {
 	return string(s), nil
 }
+
+// ErrIllegalTransition is returned when an order is asked to move to a status its current status cannot reach
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// orderTransitions lists the statuses each status may move to, anything not listed is refused
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:   {OrderConfirmed, OrderCancelled, OrderFailed},
+	OrderConfirmed: {OrderPaid, OrderPaymentFailed, OrderCancelled},
+	OrderPaid:      {OrderShipped, OrderCancelled},
+	OrderShipped:   {OrderDelivered},
+}
+
+// IsValid reports whether the status is one of the known order statuses
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderPending, OrderShipped, OrderConfirmed, OrderCancelled, OrderDelivered, OrderPaid, OrderPaymentFailed, OrderFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanTransitionTo reports whether an order may move from this status to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCancellable reports whether an order in this status can still be cancelled,
+// orders that have left the warehouse cannot be pulled back
+func (s OrderStatus) IsCancellable() bool {
+	return s.CanTransitionTo(OrderCancelled)
+}
+
+// IsAwaitingPayment reports whether an order in this status has not been paid yet
+func (s OrderStatus) IsAwaitingPayment() bool {
+	return s == OrderPending || s == OrderConfirmed
+}
+
+// IsFinal reports whether an order in this status can not change status anymore
+func (s OrderStatus) IsFinal() bool {
+	return len(orderTransitions[s]) == 0
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrCartEmpty is returned when checking out a cart without items
+	ErrCartEmpty = errors.New("cart is empty")
+	// ErrCartChanged is returned when cart items were changed or removed after they were checked for checkout
+	ErrCartChanged = errors.New("cart was changed during checkout")
+)
+
+// GetCart returns the cart of the user. A user without a cart gets an empty one that is not stored,
+// carts are only created when the first item is added
+func (r *PostgresRepository) GetCart(userID string) (*models.Cart, error) {
+	var cart models.Cart
+	err := r.db.Where("user_id = ?", userID).First(&cart).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.Cart{UserID: userID, Currency: common.DefaultCurrency}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Where("cart_id = ?", cart.ID).Order("created_at").Find(&cart.Items).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// SaveCartItem adds the variant to the cart of the user or replaces the quantity and price of its line
+func (r *PostgresRepository) SaveCartItem(userID string, item *models.CartItem) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		cart, err := getOrCreateCart(tx, userID)
+		if err != nil {
+			return err
+		}
+		item.CartID = cart.ID
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "cart_id"}, {Name: "variant_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"quantity", "unit_price_minor", "unit_price_currency", "updated_at"}),
+		}).Create(item).Error
+	})
+}
+
+func (r *PostgresRepository) SetCartCurrency(userID, currency string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		cart, err := getOrCreateCart(tx, userID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(cart).Update("currency", currency).Error
+	})
+}
+
+// UpdateCartItemPrice stores the catalog price of a cart line, lines removed meanwhile stay removed
+func (r *PostgresRepository) UpdateCartItemPrice(itemID string, price common.Money) error {
+	return r.db.Model(&models.CartItem{}).Where("id = ?", itemID).
+		Updates(moneyColumns(map[string]interface{}{}, "unit_price", price)).Error
+}
+
+func (r *PostgresRepository) RemoveCartItem(userID, variantID string) error {
+	result := r.db.Where("variant_id = ? AND cart_id IN (?)", variantID,
+		r.db.Model(&models.Cart{}).Select("id").Where("user_id = ?", userID)).
+		Delete(&models.CartItem{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CheckoutCart creates the order like CreateOrder and removes the checked out items from the cart of the user
+// in the same transaction, so a cart is never turned into two orders. The cart row is locked while the order is
+// created. Items are matched on id and quantity, when one of them was changed or removed since it was checked
+// nothing is ordered and ErrCartChanged is returned. Items added meanwhile stay in the cart
+func (r *PostgresRepository) CheckoutCart(userID string, items []models.CartItem, order *models.Order, events ...models.OutboxMessage) (string, error) {
+	if len(items) == 0 {
+		return "", ErrCartEmpty
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var cart models.Cart
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&cart).Error
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			result := tx.Where("id = ? AND cart_id = ? AND quantity = ?", item.ID, cart.ID, item.Quantity).Delete(&models.CartItem{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrCartChanged
+			}
+		}
+		return createOrder(tx, order, events)
+	})
+	if err != nil {
+		return "", err
+	}
+	return order.OrderID, nil
+}
+
+func getOrCreateCart(db *gorm.DB, userID string) (*models.Cart, error) {
+	cart := models.Cart{UserID: userID, Currency: common.DefaultCurrency}
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&cart).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
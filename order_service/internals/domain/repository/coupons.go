@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCouponNotFound = errors.New("coupon not found")
+	ErrCouponExists   = errors.New("coupon code already exists")
+)
+
+// inactiveOrderStatuses are the statuses of orders whose coupon redemption no longer counts
+var inactiveOrderStatuses = []models.OrderStatus{models.OrderCancelled, models.OrderPaymentFailed, models.OrderFailed}
+
+func (r *PostgresRepository) CreateCoupon(coupon *models.Coupon) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Coupon{}).Where("code = ?", coupon.Code).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s", ErrCouponExists, coupon.Code)
+		}
+		return tx.Create(coupon).Error
+	})
+}
+
+func (r *PostgresRepository) GetCoupon(code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := r.db.Preload("Restrictions").First(&coupon, "code = ?", code).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrCouponNotFound, code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *PostgresRepository) GetCoupons() ([]models.Coupon, error) {
+	var coupons []models.Coupon
+	err := r.db.Preload("Restrictions").Order("created_at DESC").Find(&coupons).Error
+	if err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+// SetCouponActive switches a coupon on or off, orders that already redeemed it keep their discount
+func (r *PostgresRepository) SetCouponActive(code string, active bool) error {
+	result := r.db.Model(&models.Coupon{}).Where("code = ?", code).Update("active", active)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrCouponNotFound, code)
+	}
+	return nil
+}
+
+// CountRedemptions returns how often the coupon is used by orders that are not cancelled, in total and by the user
+func (r *PostgresRepository) CountRedemptions(couponID, userID string) (int64, int64, error) {
+	return countRedemptions(r.db, couponID, userID)
+}
+
+func countRedemptions(tx *gorm.DB, couponID, userID string) (int64, int64, error) {
+	redemptions := func() *gorm.DB {
+		return tx.Model(&models.CouponRedemption{}).
+			Joins("JOIN orders ON orders.order_id = coupon_redemptions.order_id").
+			Where("coupon_redemptions.coupon_id = ? AND orders.status NOT IN ?", couponID, inactiveOrderStatuses)
+	}
+
+	var total, byUser int64
+	if err := redemptions().Count(&total).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := redemptions().Where("coupon_redemptions.user_id = ?", userID).Count(&byUser).Error; err != nil {
+		return 0, 0, err
+	}
+	return total, byUser, nil
+}
+
+// redeemCoupon records the use of the order coupon. The coupon row is locked so concurrent orders
+// cannot both take the last use
+func redeemCoupon(tx *gorm.DB, order *models.Order) error {
+	var coupon models.Coupon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, "code = ?", order.CouponCode).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s", ErrCouponNotFound, order.CouponCode)
+	}
+	if err != nil {
+		return err
+	}
+	if err := coupon.CheckRedeemable(time.Now(), order.Currency); err != nil {
+		return err
+	}
+
+	total, byUser, err := countRedemptions(tx, coupon.ID, order.UserID)
+	if err != nil {
+		return err
+	}
+	if coupon.MaxUses > 0 && total >= int64(coupon.MaxUses) {
+		return fmt.Errorf("%w: coupon %s is used up", models.ErrCouponNotApplicable, coupon.Code)
+	}
+	if coupon.MaxUsesPerUser > 0 && byUser >= int64(coupon.MaxUsesPerUser) {
+		return fmt.Errorf("%w: coupon %s was already used %d times", models.ErrCouponNotApplicable, coupon.Code, byUser)
+	}
+
+	return tx.Create(&models.CouponRedemption{
+		CouponID: coupon.ID,
+		OrderID:  order.OrderID,
+		UserID:   order.UserID,
+		Amount:   common.Zero(order.Currency),
+	}).Error
+}
+
+// discountOrder applies the order coupon to the catalog prices. A coupon the priced order does not qualify for
+// gives no discount, it is taken off the order and its redemption is dropped so the use counts again.
+// The returned reason says why a coupon was taken off, it is empty when the coupon applied
+func discountOrder(tx *gorm.DB, order *models.Order) (string, error) {
+	var coupon models.Coupon
+	err := tx.Preload("Restrictions").First(&coupon, "code = ?", order.CouponCode).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	if err == nil {
+		err = order.ApplyCoupon(&coupon)
+	} else {
+		err = fmt.Errorf("%w: coupon %s no longer exists", models.ErrCouponNotApplicable, order.CouponCode)
+	}
+	if errors.Is(err, models.ErrCouponNotApplicable) {
+		reason := fmt.Sprintf("coupon %s removed, %v", order.CouponCode, err)
+		order.CouponCode = ""
+		if err := tx.Where("order_id = ?", order.OrderID).Delete(&models.CouponRedemption{}).Error; err != nil {
+			return "", err
+		}
+		return reason, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Model(&models.CouponRedemption{}).Where("order_id = ?", order.OrderID).
+		Updates(moneyColumns(map[string]interface{}{}, "amount", order.DiscountTotal)).Error
+	return "", err
+}
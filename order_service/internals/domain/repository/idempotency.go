@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetIdempotencyKey returns the unexpired key of the user, gorm.ErrRecordNotFound when there is none
+func (r *PostgresRepository) GetIdempotencyKey(userID, key string) (*models.IdempotencyKey, error) {
+	var stored models.IdempotencyKey
+	err := r.db.Where("user_id = ? AND key = ? AND expires_at > ?", userID, key, time.Now()).First(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// CreateOrderIdempotent is CreateOrder guarded by an idempotency key. The key is claimed in the same transaction
+// as the order, so of two concurrent requests with the same key only one creates an order. When the key is already
+// taken the stored key is returned and nothing is created, a key taken by a different request fails with
+// models.ErrIdempotencyKeyReused. Expired keys are reused
+func (r *PostgresRepository) CreateOrderIdempotent(key *models.IdempotencyKey, order *models.Order, events ...models.OutboxMessage) (*models.IdempotencyKey, error) {
+	var existing *models.IdempotencyKey
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Waits for a concurrent transaction holding the same key to finish
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			var stored models.IdempotencyKey
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ? AND key = ?", key.UserID, key.Key).First(&stored).Error
+			if err != nil {
+				return err
+			}
+
+			if stored.ExpiresAt.After(time.Now()) {
+				if !stored.Matches(key.RequestHash) {
+					return models.ErrIdempotencyKeyReused
+				}
+				existing = &stored
+				return nil
+			}
+
+			if err := tx.Where("user_id = ? AND key = ?", key.UserID, key.Key).Delete(&models.IdempotencyKey{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(key).Error; err != nil {
+				return err
+			}
+		}
+
+		return createOrder(tx, order, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// PurgeIdempotencyKeys deletes keys that expired before now
+func (r *PostgresRepository) PurgeIdempotencyKeys(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
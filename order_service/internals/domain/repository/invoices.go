@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *PostgresRepository) GetInvoiceByOrderID(orderID string) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := r.db.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).First(&invoice, "order_id = ?", orderID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// IssueInvoice stores the invoice the build callback makes of the locked order under the next number of its year.
+// An order is invoiced once, when it already has an invoice that one is returned and build is not called
+func (r *PostgresRepository) IssueInvoice(orderID string, build func(order *models.Order) (*models.Invoice, error)) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("OrderItems").
+			First(&order, "order_id = ?", orderID).Error
+		if err != nil {
+			return err
+		}
+
+		var existing models.Invoice
+		err = tx.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).Where("order_id = ?", orderID).Limit(1).Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		if existing.ID != "" {
+			invoice = &existing
+			return nil
+		}
+
+		invoice, err = build(&order)
+		if err != nil {
+			return err
+		}
+
+		// The upsert keeps the year's row locked until commit, numbers of rolled back issues are handed out again
+		var sequence int64
+		err = tx.Raw(`INSERT INTO invoice_sequences (year, last_number) VALUES (?, 1)
+			ON CONFLICT (year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+			RETURNING last_number`, invoice.Year).Scan(&sequence).Error
+		if err != nil {
+			return err
+		}
+		invoice.AssignNumber(sequence)
+
+		return tx.Create(invoice).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL and migrates it, tests that need postgres skip without it
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("error connecting to the test database: %v", err)
+	}
+	if err := models.AutoMigrate(db); err != nil {
+		t.Fatalf("error migrating the test database: %v", err)
+	}
+	return db
+}
+
+// invoiceYear picks a year no other test run numbers invoices in, so the sequence starts at one
+func invoiceYear(t *testing.T, db *gorm.DB) time.Time {
+	t.Helper()
+	year := 3000 + int(time.Now().UnixNano()%5000)
+	t.Cleanup(func() {
+		db.Where("year = ?", year).Delete(&models.Invoice{})
+		db.Where("year = ?", year).Delete(&models.InvoiceSequence{})
+	})
+	return time.Date(year, time.March, 1, 12, 0, 0, 0, time.UTC)
+}
+
+// confirmedOrders stores n confirmed orders that can be invoiced and removes them after the test
+func confirmedOrders(t *testing.T, db *gorm.DB, n int) []string {
+	t.Helper()
+	orderIDs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		order := models.Order{
+			UserID:        "invoice-test",
+			Quantity:      1,
+			Status:        models.OrderConfirmed,
+			Currency:      "USD",
+			Subtotal:      common.NewMoney(1000, "USD"),
+			DiscountTotal: common.Zero("USD"),
+			TaxTotal:      common.Zero("USD"),
+			TotalAmount:   common.NewMoney(1000, "USD"),
+			OrderItems: []models.OrderItem{{
+				ProductID: "variant",
+				Price:     common.NewMoney(1000, "USD"),
+				Quantity:  1,
+				Discount:  common.Zero("USD"),
+				Tax:       common.Zero("USD"),
+			}},
+		}
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatalf("error creating order: %v", err)
+		}
+		orderIDs = append(orderIDs, order.OrderID)
+	}
+	t.Cleanup(func() {
+		db.Where("order_id IN ?", orderIDs).Delete(&models.Invoice{})
+		db.Where("order_id IN ?", orderIDs).Delete(&models.Order{})
+	})
+	return orderIDs
+}
+
+func issue(repo *PostgresRepository, orderID string, issuedAt time.Time) (*models.Invoice, error) {
+	return repo.IssueInvoice(orderID, func(order *models.Order) (*models.Invoice, error) {
+		return order.NewInvoice(models.Buyer{UserID: order.UserID, Name: "Test Buyer"}, issuedAt)
+	})
+}
+
+// TestIssueInvoiceConcurrently has many orders invoiced at once, their numbers have to be 1 to n without gaps
+func TestIssueInvoiceConcurrently(t *testing.T) {
+	db := testDB(t)
+	repo := NewPostgresRepository(db)
+	issuedAt := invoiceYear(t, db)
+
+	const orders = 20
+	orderIDs := confirmedOrders(t, db, orders)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		sequences []int64
+	)
+	for _, orderID := range orderIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			invoice, err := issue(repo, orderID, issuedAt)
+			if err != nil {
+				t.Errorf("error issuing invoice of order %s: %v", orderID, err)
+				return
+			}
+			mu.Lock()
+			sequences = append(sequences, invoice.Sequence)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(sequences)
+	for i, sequence := range sequences {
+		if sequence != int64(i+1) {
+			t.Fatalf("invoice numbers are not consecutive: %v", sequences)
+		}
+	}
+	if len(sequences) != orders {
+		t.Errorf("issued %d invoices for %d orders", len(sequences), orders)
+	}
+
+	// Issuing again returns the stored invoice and takes no number
+	again, err := issue(repo, orderIDs[0], issuedAt)
+	if err != nil {
+		t.Fatalf("error issuing invoice again: %v", err)
+	}
+	var last models.InvoiceSequence
+	if err := db.First(&last, "year = ?", issuedAt.Year()).Error; err != nil {
+		t.Fatalf("error loading the sequence: %v", err)
+	}
+	if last.LastNumber != orders || again.Sequence > orders {
+		t.Errorf("reissue took a number: last number %d, sequence %d", last.LastNumber, again.Sequence)
+	}
+}
+
+// TestIssueInvoiceRollback fails an issue after it took a number, the next invoice has to get that number
+func TestIssueInvoiceRollback(t *testing.T) {
+	db := testDB(t)
+	repo := NewPostgresRepository(db)
+	issuedAt := invoiceYear(t, db)
+	orderIDs := confirmedOrders(t, db, 3)
+
+	first, err := issue(repo, orderIDs[0], issuedAt)
+	if err != nil {
+		t.Fatalf("error issuing the first invoice: %v", err)
+	}
+
+	// An invoice the database refuses fails after the number was taken and rolls back
+	_, err = repo.IssueInvoice(orderIDs[1], func(order *models.Order) (*models.Invoice, error) {
+		invoice, err := order.NewInvoice(models.Buyer{UserID: order.UserID}, issuedAt)
+		if err != nil {
+			return nil, err
+		}
+		invoice.Currency = "TOO LONG"
+		return invoice, nil
+	})
+	if err == nil {
+		t.Fatal("expected the broken invoice to fail")
+	}
+	var count int64
+	if err := db.Model(&models.Invoice{}).Where("order_id = ?", orderIDs[1]).Count(&count).Error; err != nil || count != 0 {
+		t.Fatalf("failed issue left %d invoices: %v", count, err)
+	}
+
+	second, err := issue(repo, orderIDs[2], issuedAt)
+	if err != nil {
+		t.Fatalf("error issuing the second invoice: %v", err)
+	}
+	if first.Sequence != 1 || second.Sequence != 2 {
+		t.Errorf("sequences %d and %d, want 1 and 2", first.Sequence, second.Sequence)
+	}
+}
@@ -1,6 +1,10 @@
 package repository
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
 	"github.com/palashbhasme/order_service/internals/domain/models"
 	"gorm.io/gorm"
 )
@@ -15,17 +19,34 @@ func NewPostgresRepository(db *gorm.DB) *PostgresRepository {
 	}
 }
 
-func (r *PostgresRepository) CreateOrder(order *models.Order) (string, error) {
-	result := r.db.Create(order)
-	if result.Error != nil {
-		return "", result.Error
+// CreateOrder saves the order together with the events announcing it, either all of them are stored or none.
+// The order coupon is redeemed in the same transaction, an unknown coupon fails with ErrCouponNotFound and
+// one the order cannot use with models.ErrCouponNotApplicable
+func (r *PostgresRepository) CreateOrder(order *models.Order, events ...models.OutboxMessage) (string, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		return createOrder(tx, order, events)
+	})
+	if err != nil {
+		return "", err
 	}
 	return order.OrderID, nil
 }
 
+func createOrder(tx *gorm.DB, order *models.Order, events []models.OutboxMessage) error {
+	if err := tx.Create(order).Error; err != nil {
+		return err
+	}
+	if order.CouponCode != "" {
+		if err := redeemCoupon(tx, order); err != nil {
+			return err
+		}
+	}
+	return enqueueOutbox(tx, events)
+}
+
 func (r *PostgresRepository) GetOrderByID(id string) (*models.Order, error) {
 	var order models.Order
-	err := r.db.Preload("OrderItems").Model(models.Order{}).First(&order, "order_id = ?", id).Error
+	err := r.db.Preload("OrderItems").Preload("Refunds.Items").Preload("Returns.Items").Preload("Shipments.Items").Model(models.Order{}).First(&order, "order_id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -54,16 +75,176 @@ func (r *PostgresRepository) CreateOrderItem(orderItem *models.OrderItem) error
 	return r.db.Create(&orderItem).Error
 }
 
-func (r *PostgresRepository) UpdateOrderStatus(id string, updates map[string]interface{}) error {
-	return r.db.Model(&models.Order{}).Where("order_id = ?", id).Updates(updates).Error
+// TransitionStatus moves an order from one status to another and records the change in the order history.
+// The transition has to be allowed by the order state machine, and the update only applies if the order
+// is still in the from status when it runs. Events are queued in the outbox within the same transaction.
+// Changes coming from a consumer are recorded in the inbox, a redelivery returns common.ErrDuplicateMessage
+func (r *PostgresRepository) TransitionStatus(orderID string, from, to models.OrderStatus, change models.StatusChange, events ...models.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return transitionStatus(tx, orderID, from, to, change, events)
+	})
 }
 
-func (r *PostgresRepository) GetOrdersByUserID(userID string) ([]models.Order, error) {
-	var orders []models.Order
-	err := r.db.Preload("OrderItems").Model(models.Order{}).Find(&orders, "user_id = ?", userID).Error
+// ConfirmOrder is TransitionStatus to confirmed which also stores the catalog prices on the order and its items,
+// takes the coupon discount off the total and adds the tax worked out by the tax callback. A coupon the priced
+// order no longer qualifies for is removed from the order, why is recorded with the status change.
+// The events callback builds the messages of the confirmation from the priced and taxed order.
+// Prices in another currency than the order currency fail with common.ErrCurrencyMismatch
+func (r *PostgresRepository) ConfirmOrder(orderID string, from models.OrderStatus, pricing models.OrderPricing, tax func(order *models.Order) error, change models.StatusChange, events func(order *models.Order) ([]models.OutboxMessage, error)) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Preload("OrderItems").First(&order, "order_id = ?", orderID).Error; err != nil {
+			return err
+		}
+		if err := order.ApplyPricing(pricing); err != nil {
+			return err
+		}
+		if order.CouponCode != "" {
+			dropped, err := discountOrder(tx, &order)
+			if err != nil {
+				return err
+			}
+			if dropped != "" {
+				change.Reason = strings.TrimPrefix(change.Reason+"; "+dropped, "; ")
+			}
+		}
+		if err := tax(&order); err != nil {
+			return err
+		}
+		messages, err := events(&order)
+		if err != nil {
+			return err
+		}
+
+		if err := transitionStatus(tx, orderID, from, models.OrderConfirmed, change, messages); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"price_mismatch": order.PriceMismatch, "coupon_code": order.CouponCode}
+		moneyColumns(updates, "total_amount", order.TotalAmount)
+		moneyColumns(updates, "subtotal", order.Subtotal)
+		moneyColumns(updates, "discount_total", order.DiscountTotal)
+		moneyColumns(updates, "tax_total", order.TaxTotal)
+		if err := tx.Model(&models.Order{}).Where("order_id = ?", orderID).Updates(updates).Error; err != nil {
+			return err
+		}
+		for _, item := range order.OrderItems {
+			updates := map[string]interface{}{
+				"tax_basis_points":  item.TaxBasisPoints,
+				"parent_product_id": item.ParentProductID,
+				"category_id":       item.CategoryID,
+			}
+			moneyColumns(updates, "price", item.Price)
+			moneyColumns(updates, "discount", item.Discount)
+			moneyColumns(updates, "tax", item.Tax)
+			err := tx.Model(&models.OrderItem{}).Where("id = ?", item.ID).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// moneyColumns adds an amount embedded with the column prefix to a map update
+func moneyColumns(updates map[string]interface{}, column string, amount common.Money) map[string]interface{} {
+	updates[column+"_minor"] = amount.Amount
+	updates[column+"_currency"] = amount.Currency
+	return updates
+}
+
+func transitionStatus(tx *gorm.DB, orderID string, from, to models.OrderStatus, change models.StatusChange, events []models.OutboxMessage) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", models.ErrIllegalTransition, from, to)
+	}
+
+	if change.Consumer != "" {
+		if err := common.MarkProcessed(tx, change.Consumer, change.MessageID); err != nil {
+			return err
+		}
+	}
+
+	result := tx.Model(&models.Order{}).
+		Where("order_id = ? AND status = ?", orderID, from).
+		Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStatusConflict
+	}
+
+	event := models.OrderStatusEvent{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      change.Actor,
+		Reason:     change.Reason,
+		MessageID:  change.MessageID,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return err
+	}
+	return enqueueOutbox(tx, events)
+}
+
+// WasProcessed reports whether the consumer already handled the message
+func (r *PostgresRepository) WasProcessed(consumer, messageID string) (bool, error) {
+	return common.IsProcessed(r.db, consumer, messageID)
+}
+
+func (r *PostgresRepository) GetStatusHistory(orderID string) ([]models.OrderStatusEvent, error) {
+	var events []models.OrderStatusEvent
+	err := r.db.Where("order_id = ?", orderID).Order("created_at").Find(&events).Error
 	if err != nil {
 		return nil, err
 	}
 
-	return orders, nil
+	return events, nil
+}
+
+// ListOrders returns the requested page of orders matching the query and the number of matching orders
+func (r *PostgresRepository) ListOrders(query models.OrderQuery) ([]models.Order, int64, error) {
+	db := r.db.Model(&models.Order{})
+	if query.UserID != "" {
+		db = db.Where("user_id = ?", query.UserID)
+	}
+	if len(query.Statuses) > 0 {
+		db = db.Where("status IN ?", query.Statuses)
+	}
+	if !query.From.IsZero() {
+		db = db.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("created_at < ?", query.To)
+	}
+	if query.ProductID != "" {
+		db = db.Where("order_id IN (?)", r.db.Model(&models.OrderItem{}).Select("order_id").Where("product_id = ?", query.ProductID))
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	sortBy, ok := models.OrderSortColumns[query.SortBy]
+	if !ok {
+		sortBy = models.OrderSortColumns["created_at"]
+	}
+	direction := "DESC"
+	if query.Ascending {
+		direction = "ASC"
+	}
+
+	var orders []models.Order
+	err := db.Preload("OrderItems").Preload("Refunds.Items").Preload("Returns.Items").Preload("Shipments.Items").
+		Order(fmt.Sprintf("%s %s, order_id %s", sortBy, direction, direction)).
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&orders).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return orders, total, nil
 }
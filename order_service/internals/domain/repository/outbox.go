@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxOutboxBackoff caps the wait between two publish attempts of the same message
+	maxOutboxBackoff = 5 * time.Minute
+	// outboxClaimTimeout is how long claimed messages are left to the relay that claimed them
+	outboxClaimTimeout = time.Minute
+)
+
+// EnqueueOutbox stores events that are not tied to any other change
+func (r *PostgresRepository) EnqueueOutbox(events ...models.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return enqueueOutbox(tx, events)
+	})
+}
+
+// ProcessOutbox hands up to limit unsent messages to publish and marks them sent or schedules a retry.
+// The messages are claimed in a short transaction and published after it committed, so a slow broker
+// does not hold row locks or a connection. Each outcome is then stored on its own
+func (r *PostgresRepository) ProcessOutbox(limit int, publish func(models.OutboxMessage) error) (int, error) {
+	pending, err := r.claimOutbox(limit)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, msg := range pending {
+		now := time.Now()
+		if err := publish(msg); err != nil {
+			attempts := msg.Attempts + 1
+			err = r.db.Model(&models.OutboxMessage{}).Where("id = ?", msg.ID).Updates(map[string]interface{}{
+				"attempts":        attempts,
+				"last_error":      err.Error(),
+				"next_attempt_at": now.Add(outboxBackoff(attempts)),
+			}).Error
+			if err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		err := r.db.Model(&models.OutboxMessage{}).Where("id = ?", msg.ID).Update("sent_at", now).Error
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// claimOutbox picks up to limit due messages and moves their next attempt past the claim timeout. Rows are
+// locked with SKIP LOCKED so several relays never claim the same message, a relay that dies while publishing
+// leaves its messages to be claimed again once the timeout passed
+func (r *PostgresRepository) claimOutbox(limit int) ([]models.OutboxMessage, error) {
+	var pending []models.OutboxMessage
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND next_attempt_at <= ?", now).
+			Order("created_at").
+			Limit(limit).
+			Find(&pending).Error
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+
+		ids := make([]string, len(pending))
+		for i, msg := range pending {
+			ids[i] = msg.ID
+		}
+		return tx.Model(&models.OutboxMessage{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(outboxClaimTimeout)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// enqueueOutbox writes events with the transaction of the change they belong to
+func enqueueOutbox(tx *gorm.DB, events []models.OutboxMessage) error {
+	for i := range events {
+		if events[i].NextAttemptAt.IsZero() {
+			events[i].NextAttemptAt = time.Now()
+		}
+		// Events with a fixed id are only ever queued once
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&events[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outboxBackoff doubles the wait after every failed attempt, starting at one second
+func outboxBackoff(attempts int) time.Duration {
+	backoff := time.Second
+	for i := 1; i < attempts && backoff < maxOutboxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxOutboxBackoff {
+		return maxOutboxBackoff
+	}
+	return backoff
+}
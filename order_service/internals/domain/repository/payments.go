@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+)
+
+// RecordPaymentAttempt stores the outcome of a charge together with the events announcing it. The payment request
+// is recorded in the inbox in the same transaction, a redelivery returns common.ErrDuplicateMessage
+func (r *PostgresRepository) RecordPaymentAttempt(consumer, messageID string, attempt *models.PaymentAttempt, events ...models.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := common.MarkProcessed(tx, consumer, messageID); err != nil {
+			return err
+		}
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+		return enqueueOutbox(tx, events)
+	})
+}
+
+func (r *PostgresRepository) GetPaymentAttempts(orderID string) ([]models.PaymentAttempt, error) {
+	var attempts []models.PaymentAttempt
+	err := r.db.Where("order_id = ?", orderID).Order("created_at").Find(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRefundConflict is returned when a refund is no longer requested when it is completed
+var ErrRefundConflict = errors.New("refund was already completed")
+
+// RequestRefund stores the refund built for the order together with its events. The order is locked while the
+// refund is built, so concurrent refunds always see each other and cannot give back more than was captured
+func (r *PostgresRepository) RequestRefund(orderID string, build func(order *models.Order, captured *models.PaymentAttempt) (*models.Refund, error), events ...models.OutboxMessage) (*models.Refund, error) {
+	var refund *models.Refund
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		refund, err = requestRefund(tx, orderID, build)
+		if err != nil {
+			return err
+		}
+		return enqueueOutbox(tx, events)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// CancelPaidOrder cancels a paid order and requests the refund built for it in the same transaction, so the
+// order is never cancelled without its payment being given back. Events go out with the cancellation
+func (r *PostgresRepository) CancelPaidOrder(orderID string, change models.StatusChange, build func(order *models.Order, captured *models.PaymentAttempt) (*models.Refund, error), events ...models.OutboxMessage) (*models.Refund, error) {
+	var refund *models.Refund
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := transitionStatus(tx, orderID, models.OrderPaid, models.OrderCancelled, change, events); err != nil {
+			return err
+		}
+		var err error
+		refund, err = requestRefund(tx, orderID, build)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func requestRefund(tx *gorm.DB, orderID string, build func(order *models.Order, captured *models.PaymentAttempt) (*models.Refund, error)) (*models.Refund, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: clause.CurrentTable}}).
+		Preload("OrderItems").Preload("Refunds.Items").Preload("Returns.Items").
+		First(&order, "order_id = ?", orderID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var captured models.PaymentAttempt
+	err = tx.Where("order_id = ? AND status = ?", orderID, models.PaymentSucceeded).
+		Order("created_at DESC").First(&captured).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: order was never paid", models.ErrRefundNotAllowed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refund, err := build(&order, &captured)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Create(refund).Error; err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (r *PostgresRepository) GetRefund(id string) (*models.Refund, error) {
+	var refund models.Refund
+	err := r.db.Preload("Items").First(&refund, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// CompleteRefund stores the outcome of a refund at the provider together with the events announcing it.
+// The refund request is recorded in the inbox in the same transaction, a redelivery returns common.ErrDuplicateMessage
+func (r *PostgresRepository) CompleteRefund(consumer, messageID string, refund *models.Refund, events ...models.OutboxMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := common.MarkProcessed(tx, consumer, messageID); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Refund{}).
+			Where("id = ? AND status = ?", refund.ID, models.RefundRequested).
+			Updates(map[string]interface{}{
+				"status":         refund.Status,
+				"provider_ref":   refund.ProviderRef,
+				"failure_reason": refund.FailureReason,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefundConflict
+		}
+		return enqueueOutbox(tx, events)
+	})
+}
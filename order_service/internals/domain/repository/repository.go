@@ -1,12 +1,82 @@
 package repository
 
-import "github.com/palashbhasme/order_service/internals/domain/models"
+import (
+	"errors"
+	"time"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+// ErrStatusConflict is returned when an order no longer has the status a transition expected
+var ErrStatusConflict = errors.New("order status was changed concurrently")
 
 type OrdersRepository interface {
-	CreateOrder(order *models.Order) (string, error)
+	CreateOrder(order *models.Order, events ...models.OutboxMessage) (string, error)
+	CreateOrderIdempotent(key *models.IdempotencyKey, order *models.Order, events ...models.OutboxMessage) (*models.IdempotencyKey, error)
+	GetIdempotencyKey(userID, key string) (*models.IdempotencyKey, error)
+	PurgeIdempotencyKeys(now time.Time) (int64, error)
 	GetOrderByID(id string) (*models.Order, error)
 	UpdateOrder(id string, order *models.Order) error
 	CreateOrderItem(orderItem *models.OrderItem) error
-	UpdateOrderStatus(id string, updates map[string]interface{}) error
-	GetOrdersByUserID(userID string) ([]models.Order, error)
+	TransitionStatus(orderID string, from, to models.OrderStatus, change models.StatusChange, events ...models.OutboxMessage) error
+	ConfirmOrder(orderID string, from models.OrderStatus, pricing models.OrderPricing, tax func(order *models.Order) error, change models.StatusChange, events func(order *models.Order) ([]models.OutboxMessage, error)) error
+	GetStatusHistory(orderID string) ([]models.OrderStatusEvent, error)
+	WasProcessed(consumer, messageID string) (bool, error)
+	ListOrders(query models.OrderQuery) ([]models.Order, int64, error)
+	GetPaymentAttempts(orderID string) ([]models.PaymentAttempt, error)
+	RequestRefund(orderID string, build func(order *models.Order, captured *models.PaymentAttempt) (*models.Refund, error), events ...models.OutboxMessage) (*models.Refund, error)
+	CancelPaidOrder(orderID string, change models.StatusChange, build func(order *models.Order, captured *models.PaymentAttempt) (*models.Refund, error), events ...models.OutboxMessage) (*models.Refund, error)
+	CreateReturn(orderID string, build func(order *models.Order) (*models.ReturnRequest, error)) (*models.ReturnRequest, error)
+	GetReturn(orderID, returnID string) (*models.ReturnRequest, error)
+	TransitionReturn(ret *models.ReturnRequest, from models.ReturnStatus, events ...models.OutboxMessage) error
+	CreateShipment(orderID string, build func(order *models.Order) (*models.Shipment, error), change models.StatusChange) (*models.Shipment, error)
+	DeliverShipment(orderID, shipmentID string, change models.StatusChange) (*models.Shipment, error)
+	OutboxRepository
+}
+
+type RefundRepository interface {
+	GetRefund(id string) (*models.Refund, error)
+	WasProcessed(consumer, messageID string) (bool, error)
+	CompleteRefund(consumer, messageID string, refund *models.Refund, events ...models.OutboxMessage) error
+}
+
+type PaymentRepository interface {
+	GetOrderByID(id string) (*models.Order, error)
+	WasProcessed(consumer, messageID string) (bool, error)
+	RecordPaymentAttempt(consumer, messageID string, attempt *models.PaymentAttempt, events ...models.OutboxMessage) error
+}
+
+type CartRepository interface {
+	GetCart(userID string) (*models.Cart, error)
+	SaveCartItem(userID string, item *models.CartItem) error
+	UpdateCartItemPrice(itemID string, price common.Money) error
+	SetCartCurrency(userID, currency string) error
+	RemoveCartItem(userID, variantID string) error
+	CheckoutCart(userID string, items []models.CartItem, order *models.Order, events ...models.OutboxMessage) (string, error)
+}
+
+type CouponRepository interface {
+	CreateCoupon(coupon *models.Coupon) error
+	GetCoupon(code string) (*models.Coupon, error)
+	GetCoupons() ([]models.Coupon, error)
+	SetCouponActive(code string, active bool) error
+	CountRedemptions(couponID, userID string) (int64, int64, error)
+}
+
+type TaxRateRepository interface {
+	GetTaxRates(country string) ([]models.TaxRate, error)
+	GetAllTaxRates() ([]models.TaxRate, error)
+	UpsertTaxRate(rate *models.TaxRate) error
+	DeleteTaxRate(id string) error
+}
+
+type InvoiceRepository interface {
+	GetInvoiceByOrderID(orderID string) (*models.Invoice, error)
+	IssueInvoice(orderID string, build func(order *models.Order) (*models.Invoice, error)) (*models.Invoice, error)
+}
+
+type OutboxRepository interface {
+	EnqueueOutbox(events ...models.OutboxMessage) error
+	ProcessOutbox(limit int, publish func(models.OutboxMessage) error) (int, error)
 }
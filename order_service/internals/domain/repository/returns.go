@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateReturn stores the return built for the order. The order is locked while the return is built,
+// so concurrent returns cannot send back more than was delivered
+func (r *PostgresRepository) CreateReturn(orderID string, build func(order *models.Order) (*models.ReturnRequest, error)) (*models.ReturnRequest, error) {
+	var ret *models.ReturnRequest
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: clause.CurrentTable}}).
+			Preload("OrderItems").Preload("Returns.Items").
+			First(&order, "order_id = ?", orderID).Error
+		if err != nil {
+			return err
+		}
+
+		ret, err = build(&order)
+		if err != nil {
+			return err
+		}
+		return tx.Create(ret).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (r *PostgresRepository) GetReturn(orderID, returnID string) (*models.ReturnRequest, error) {
+	var ret models.ReturnRequest
+	err := r.db.Preload("Items").First(&ret, "id = ? AND order_id = ?", returnID, orderID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// TransitionReturn stores the new status of a return along with the review fields and item conditions.
+// The update only applies if the return is still in the from status, events are queued in the same transaction
+func (r *PostgresRepository) TransitionReturn(ret *models.ReturnRequest, from models.ReturnStatus, events ...models.OutboxMessage) error {
+	if !from.CanTransitionTo(ret.Status) {
+		return fmt.Errorf("%w: %s -> %s", models.ErrIllegalTransition, from, ret.Status)
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ReturnRequest{}).
+			Where("id = ? AND status = ?", ret.ID, from).
+			Updates(map[string]interface{}{
+				"status":          ret.Status,
+				"reviewed_by":     ret.ReviewedBy,
+				"resolution_note": ret.ResolutionNote,
+				"received_at":     ret.ReceivedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrStatusConflict
+		}
+
+		for _, item := range ret.Items {
+			err := tx.Model(&models.ReturnItem{}).Where("id = ?", item.ID).Update("restockable", item.Restockable).Error
+			if err != nil {
+				return err
+			}
+		}
+		return enqueueOutbox(tx, events)
+	})
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrShipmentDelivered is returned when marking a shipment delivered a second time
+var ErrShipmentDelivered = errors.New("shipment was already delivered")
+
+// CreateShipment stores the shipment built for the order. The first shipment of a paid order moves it to shipped
+// through the order state machine, recorded with the given change, in the same transaction
+func (r *PostgresRepository) CreateShipment(orderID string, build func(order *models.Order) (*models.Shipment, error), change models.StatusChange) (*models.Shipment, error) {
+	var shipment *models.Shipment
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrderForFulfilment(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		shipment, err = build(order)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(shipment).Error; err != nil {
+			return err
+		}
+
+		if order.Status == models.OrderPaid {
+			return transitionStatus(tx, orderID, models.OrderPaid, models.OrderShipped, change, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shipment, nil
+}
+
+// DeliverShipment marks a shipment delivered. Once every item was shipped and every shipment arrived
+// the order moves to delivered in the same transaction
+func (r *PostgresRepository) DeliverShipment(orderID, shipmentID string, change models.StatusChange) (*models.Shipment, error) {
+	var shipment *models.Shipment
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrderForFulfilment(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		for i := range order.Shipments {
+			if order.Shipments[i].ID == shipmentID {
+				shipment = &order.Shipments[i]
+			}
+		}
+		if shipment == nil {
+			return gorm.ErrRecordNotFound
+		}
+		if shipment.Status == models.ShipmentDelivered {
+			return ErrShipmentDelivered
+		}
+
+		now := time.Now()
+		shipment.Status = models.ShipmentDelivered
+		shipment.DeliveredAt = &now
+		err = tx.Model(&models.Shipment{}).Where("id = ?", shipment.ID).Updates(map[string]interface{}{
+			"status":       shipment.Status,
+			"delivered_at": shipment.DeliveredAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if order.Status == models.OrderShipped && order.FullyDelivered() {
+			return transitionStatus(tx, orderID, models.OrderShipped, models.OrderDelivered, change, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shipment, nil
+}
+
+// lockOrderForFulfilment loads the order with its shipments and locks it so shipments are not created concurrently
+func lockOrderForFulfilment(tx *gorm.DB, orderID string) (*models.Order, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: clause.CurrentTable}}).
+		Preload("OrderItems").Preload("Shipments.Items").
+		First(&order, "order_id = ?", orderID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
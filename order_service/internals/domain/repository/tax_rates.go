@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *PostgresRepository) GetTaxRates(country string) ([]models.TaxRate, error) {
+	var rates []models.TaxRate
+	err := r.db.Where("country = ?", strings.ToUpper(country)).Find(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (r *PostgresRepository) GetAllTaxRates() ([]models.TaxRate, error) {
+	var rates []models.TaxRate
+	err := r.db.Order("country, state, category_id").Find(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// UpsertTaxRate creates the rate or replaces the existing one for the country, state and category
+func (r *PostgresRepository) UpsertTaxRate(rate *models.TaxRate) error {
+	rate.Country = strings.ToUpper(rate.Country)
+	rate.State = strings.ToUpper(rate.State)
+
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "country"}, {Name: "state"}, {Name: "category_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"basis_points", "updated_at"}),
+	}).Create(rate).Error
+}
+
+func (r *PostgresRepository) DeleteTaxRate(id string) error {
+	result := r.db.Where("id = ?", id).Delete(&models.TaxRate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/palashbhasme/order_service/internals/api/clients"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+	"github.com/palashbhasme/order_service/internals/domain/repository"
+	"gorm.io/gorm"
+)
+
+// Issuer invoices confirmed orders, the buyer details are looked up in the user service
+type Issuer struct {
+	repo  repository.InvoiceRepository
+	users clients.UserClient
+}
+
+func NewIssuer(repo repository.InvoiceRepository, users clients.UserClient) *Issuer {
+	return &Issuer{repo: repo, users: users}
+}
+
+// Issue returns the invoice of the order and issues it first when the order has none yet.
+// The token authenticates the buyer lookup and is only used for new invoices
+func (i *Issuer) Issue(token string, order *models.Order) (*models.Invoice, error) {
+	existing, err := i.repo.GetInvoiceByOrderID(order.OrderID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if !order.CanBeInvoiced() {
+		return nil, fmt.Errorf("%w: order is %s", models.ErrInvoiceNotAllowed, order.Status)
+	}
+
+	user, err := i.users.GetUser(token, order.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up buyer: %w", err)
+	}
+	buyer := models.Buyer{
+		UserID: order.UserID,
+		Name:   user.FirstName + " " + user.LastName,
+		Email:  user.Email,
+		Phone:  user.Phone,
+	}
+
+	// The order is read again under lock, it may have been cancelled since it was loaded
+	return i.repo.IssueInvoice(order.OrderID, func(locked *models.Order) (*models.Invoice, error) {
+		return locked.NewInvoice(buyer, time.Now())
+	})
+}
@@ -0,0 +1,249 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+// A4 in points, the unit of PDF coordinates. The origin is the bottom left corner
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 50
+)
+
+// The four standard fonts every PDF reader has, so nothing has to be embedded
+var fonts = []string{"Helvetica", "Helvetica-Bold", "Courier", "Courier-Bold"}
+
+const (
+	regular = "F1"
+	bold    = "F2"
+	mono    = "F3"
+	monoB   = "F4"
+)
+
+// Courier glyphs are 600/1000 of the font size wide, which lets the table line up with plain padding
+const monoWidth = 0.6
+
+const tableSize = 8
+
+var (
+	tableRow    = "%3s %-36s %5s %12s %10s %6s %10s %12s"
+	tableHeader = fmt.Sprintf(tableRow, "#", "Item", "Qty", "Unit price", "Discount", "Rate", "Tax", "Total")
+)
+
+// text is a run of text placed on a page
+type text struct {
+	x, y  float64
+	font  string
+	size  float64
+	value string
+}
+
+// layout places text top down and starts a new page when one is full
+type layout struct {
+	pages [][]text
+	y     float64
+}
+
+func (l *layout) newPage() {
+	l.pages = append(l.pages, nil)
+	l.y = pageHeight - margin
+}
+
+func (l *layout) at(x float64, font string, size float64, value string) {
+	page := len(l.pages) - 1
+	l.pages[page] = append(l.pages[page], text{x: x, y: l.y, font: font, size: size, value: value})
+}
+
+func (l *layout) line(font string, size float64, value string) {
+	if l.y-size < margin {
+		l.newPage()
+	}
+	l.y -= size
+	l.at(margin, font, size, value)
+	l.y -= size * 0.4
+}
+
+// right places a monospaced line so that it ends at the right margin
+func (l *layout) right(font string, value string) {
+	if l.y-tableSize < margin {
+		l.newPage()
+	}
+	l.y -= tableSize
+	l.at(pageWidth-margin-float64(len(value))*tableSize*monoWidth, font, tableSize, value)
+	l.y -= tableSize * 0.4
+}
+
+func (l *layout) gap(points float64) {
+	l.y -= points
+}
+
+// RenderPDF lays the invoice out on A4 pages
+func RenderPDF(inv *models.Invoice) []byte {
+	l := &layout{}
+	l.newPage()
+
+	l.line(bold, 20, "INVOICE")
+	l.gap(6)
+	l.line(regular, 10, "Invoice number: "+inv.Number)
+	l.line(regular, 10, "Issued: "+inv.IssuedAt.UTC().Format("2006-01-02"))
+	l.line(regular, 10, "Order: "+inv.OrderID)
+	if inv.CouponCode != "" {
+		l.line(regular, 10, "Coupon: "+inv.CouponCode)
+	}
+
+	l.gap(12)
+	l.line(bold, 11, "Bill to")
+	for _, value := range []string{inv.BuyerName, inv.BuyerEmail, inv.BuyerPhone} {
+		if value != "" {
+			l.line(regular, 10, value)
+		}
+	}
+
+	address := inv.ShippingAddress
+	if address.Line1 != "" {
+		l.gap(12)
+		l.line(bold, 11, "Ship to")
+		cityLine := strings.Join(nonEmpty(address.City, address.State, address.ZipCode), " ")
+		for _, value := range nonEmpty(address.Line1, address.Line2, cityLine, address.Country) {
+			l.line(regular, 10, value)
+		}
+	}
+
+	l.gap(16)
+	l.line(monoB, tableSize, tableHeader)
+	for _, line := range inv.Lines {
+		// Items continued on a new page get the column names again
+		if l.y-tableSize < margin {
+			l.newPage()
+			l.line(monoB, tableSize, tableHeader)
+		}
+		l.line(mono, tableSize, fmt.Sprintf(tableRow,
+			fmt.Sprint(line.Position),
+			truncate(line.ProductID, 36),
+			fmt.Sprint(line.Quantity),
+			line.UnitPrice.Decimal(),
+			line.Discount.Decimal(),
+			rate(line.TaxBasisPoints),
+			line.Tax.Decimal(),
+			line.Total.Decimal(),
+		))
+	}
+
+	l.gap(12)
+	l.right(mono, total("Subtotal", inv.Subtotal))
+	if !inv.DiscountTotal.IsZero() {
+		l.right(mono, total("Discount", common.NewMoney(-inv.DiscountTotal.Amount, inv.DiscountTotal.Currency)))
+	}
+	l.right(mono, total("Tax", inv.TaxTotal))
+	l.right(monoB, total("Total", inv.Total))
+
+	for i := range l.pages {
+		l.pages[i] = append(l.pages[i], text{
+			x:     margin,
+			y:     margin / 2,
+			font:  regular,
+			size:  8,
+			value: fmt.Sprintf("%s - page %d of %d", inv.Number, i+1, len(l.pages)),
+		})
+	}
+	return writePDF(l.pages)
+}
+
+func total(label string, amount common.Money) string {
+	return fmt.Sprintf("%-10s %14s %s", label, amount.Decimal(), amount.Currency)
+}
+
+// rate prints basis points as a percentage, 825 is 8.25%
+func rate(basisPoints int) string {
+	return fmt.Sprintf("%d.%02d%%", basisPoints/100, basisPoints%100)
+}
+
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length-1]) + "~"
+}
+
+func nonEmpty(values ...string) []string {
+	var kept []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// writePDF writes a PDF 1.4 file with a content stream per page. Objects are numbered catalog, page tree,
+// the fonts, then a page and its content for every page
+func writePDF(pages [][]text) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	firstPage := 3 + len(fonts)
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+
+	var resources strings.Builder
+	for i, font := range fonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font))
+		fmt.Fprintf(&resources, "/F%d %d 0 R ", i+1, 3+i)
+	}
+
+	for i, page := range pages {
+		var content bytes.Buffer
+		for _, t := range page {
+			fmt.Fprintf(&content, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", t.font, t.size, t.x, t.y, escape(t.value))
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, resources.String(), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// escape encodes text for a PDF string in WinAnsiEncoding, characters it cannot show become '?'
+func escape(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			b.WriteByte(byte(r))
+		case r == '€':
+			b.WriteByte(0x80)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
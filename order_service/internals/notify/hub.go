@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+const subscriberBuffer = 16
+
+// StatusEvent announces an order status change that was committed
+type StatusEvent struct {
+	OrderID    string             `json:"order_id"`
+	FromStatus models.OrderStatus `json:"from_status,omitempty"`
+	ToStatus   models.OrderStatus `json:"to_status"`
+	Actor      string             `json:"actor,omitempty"`
+	Reason     string             `json:"reason,omitempty"`
+	At         time.Time          `json:"at"`
+}
+
+// Hub fans order status changes out to the subscribers of each order. It only reaches subscribers of this
+// process, publishers have to call it after the change was committed
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan StatusEvent]struct{} // Keyed by order id
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[string]map[chan StatusEvent]struct{})}
+}
+
+// Subscribe returns the status changes of the order and a function that ends the subscription.
+// The channel is closed when the subscription ends, also when the subscriber falls too far behind
+func (h *Hub) Subscribe(orderID string) (<-chan StatusEvent, func()) {
+	ch := make(chan StatusEvent, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[orderID] == nil {
+		h.subscribers[orderID] = make(map[chan StatusEvent]struct{})
+	}
+	h.subscribers[orderID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(orderID, ch)
+	}
+}
+
+// Publish hands the event to every subscriber of the order without blocking. A subscriber whose buffer is full
+// is dropped instead of holding up the publisher, it has to subscribe again and reload the order
+func (h *Hub) Publish(event StatusEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[event.OrderID] {
+		select {
+		case ch <- event:
+		default:
+			h.remove(event.OrderID, ch)
+		}
+	}
+}
+
+// remove closes the channel once, the caller holds the lock
+func (h *Hub) remove(orderID string, ch chan StatusEvent) {
+	subscribers, ok := h.subscribers[orderID]
+	if !ok {
+		return
+	}
+	if _, ok := subscribers[ch]; !ok {
+		return
+	}
+	delete(subscribers, ch)
+	close(ch)
+	if len(subscribers) == 0 {
+		delete(h.subscribers, orderID)
+	}
+}
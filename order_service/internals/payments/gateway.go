@@ -0,0 +1,47 @@
+package payments
+
+import (
+	"errors"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+// ErrGatewayUnavailable is returned when the gateway could not be reached, the charge can be retried
+var ErrGatewayUnavailable = errors.New("payment gateway unavailable")
+
+// ChargeRequest asks a gateway to collect the amount of an order
+type ChargeRequest struct {
+	OrderID        string
+	UserID         string
+	Amount         common.Money
+	IdempotencyKey string // Charging again with the same key returns the first result instead of collecting twice
+}
+
+// ChargeResult is the outcome of a charge the gateway processed, a declined charge is not an error
+type ChargeResult struct {
+	Reference     string // Charge id at the provider
+	Approved      bool
+	DeclineReason string
+}
+
+// RefundRequest asks a gateway to give back part or all of an earlier charge
+type RefundRequest struct {
+	OrderID        string
+	PaymentRef     string // Reference of the charge being refunded
+	Amount         common.Money
+	IdempotencyKey string
+}
+
+// RefundResult is the outcome of a refund the gateway processed, a declined refund is not an error
+type RefundResult struct {
+	Reference     string // Refund id at the provider
+	Approved      bool
+	DeclineReason string
+}
+
+// PaymentGateway collects payments from a provider and gives them back
+type PaymentGateway interface {
+	Name() string
+	Charge(request ChargeRequest) (ChargeResult, error)
+	Refund(request RefundRequest) (RefundResult, error)
+}
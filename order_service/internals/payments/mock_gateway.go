@@ -0,0 +1,59 @@
+package payments
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+)
+
+// MockGateway is an in-process gateway for local runs and tests. It never calls out and always gives the same
+// result for the same request: amounts ending in 13 cents (e.g. 10.13) are declined, everything else is approved.
+// The same rule applies to refunds.
+// References are derived from the idempotency key so a retried charge returns the first reference
+type MockGateway struct{}
+
+func NewMockGateway() *MockGateway {
+	return &MockGateway{}
+}
+
+func (g *MockGateway) Name() string {
+	return "mock"
+}
+
+func (g *MockGateway) Charge(request ChargeRequest) (ChargeResult, error) {
+	result := ChargeResult{
+		Reference: mockReference("ch", request.OrderID, request.IdempotencyKey),
+		Approved:  true,
+	}
+	if declined(request.Amount) {
+		result.Approved = false
+		result.DeclineReason = "card declined"
+	}
+	return result, nil
+}
+
+func (g *MockGateway) Refund(request RefundRequest) (RefundResult, error) {
+	result := RefundResult{
+		Reference: mockReference("re", request.PaymentRef, request.IdempotencyKey),
+		Approved:  true,
+	}
+	if declined(request.Amount) {
+		result.Approved = false
+		result.DeclineReason = "refund declined"
+	}
+	return result, nil
+}
+
+func mockReference(prefix, id, idempotencyKey string) string {
+	sum := sha1.Sum([]byte(id + "/" + idempotencyKey))
+	return "mock_" + prefix + "_" + hex.EncodeToString(sum[:8])
+}
+
+func declined(amount common.Money) bool {
+	minor := amount.Amount
+	if minor < 0 {
+		minor = -minor
+	}
+	return minor%100 == 13
+}
@@ -0,0 +1,53 @@
+package tax
+
+import (
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+// Line is an order item to tax, the amount already has the discount taken off
+type Line struct {
+	OrderItemID string
+	ProductID   string
+	CategoryID  string
+	Amount      common.Money
+}
+
+// Request asks for the tax of the lines of an order shipped to the address
+type Request struct {
+	OrderID string
+	Country string
+	State   string
+	Lines   []Line
+}
+
+// Calculator works out the tax of order lines, implementations may use a rate table or an external service
+type Calculator interface {
+	Name() string
+	Calculate(req Request) ([]models.LineTax, error)
+}
+
+// Apply taxes a priced and discounted order with the calculator
+func Apply(calculator Calculator, order *models.Order) error {
+	req := Request{
+		OrderID: order.OrderID,
+		Country: order.ShippingAddress.Country,
+		State:   order.ShippingAddress.State,
+		Lines:   make([]Line, 0, len(order.OrderItems)),
+	}
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+		req.Lines = append(req.Lines, Line{
+			OrderItemID: item.ID,
+			ProductID:   item.ParentProductID,
+			CategoryID:  item.CategoryID,
+			Amount:      item.NetAmount(),
+		})
+	}
+
+	lines, err := calculator.Calculate(req)
+	if err != nil {
+		return err
+	}
+	return order.ApplyTax(lines)
+}
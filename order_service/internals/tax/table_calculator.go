@@ -0,0 +1,92 @@
+package tax
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/palashbhasme/ecommerce_microservices/common"
+	"github.com/palashbhasme/order_service/internals/domain/models"
+)
+
+// ErrNoTaxRate is returned for order lines no rate of the table matches. Countries without tax need a rate
+// of 0 basis points, so an address the table does not know is never taxed at 0% by accident
+var ErrNoTaxRate = errors.New("no tax rate matches")
+
+// RateSource looks up the tax rates of a country
+type RateSource interface {
+	GetTaxRates(country string) ([]models.TaxRate, error)
+}
+
+// TableCalculator charges the most specific rate of the rate table for every line: a rate for the state and
+// category wins over one for the state, which wins over one for the category, which wins over the country rate.
+// Lines without a matching rate fail with ErrNoTaxRate
+type TableCalculator struct {
+	rates RateSource
+}
+
+func NewTableCalculator(rates RateSource) *TableCalculator {
+	return &TableCalculator{rates: rates}
+}
+
+func (t *TableCalculator) Name() string {
+	return "table"
+}
+
+func (t *TableCalculator) Calculate(req Request) ([]models.LineTax, error) {
+	if req.Country == "" {
+		return nil, fmt.Errorf("%w: order %s has no shipping country", ErrNoTaxRate, req.OrderID)
+	}
+	rates, err := t.rates.GetTaxRates(strings.ToUpper(req.Country))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]models.LineTax, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		rate, ok := bestRate(rates, req.State, line.CategoryID)
+		if !ok {
+			return nil, fmt.Errorf("%w: country %s, state %q, category %q", ErrNoTaxRate, req.Country, req.State, line.CategoryID)
+		}
+		lines = append(lines, models.LineTax{
+			OrderItemID: line.OrderItemID,
+			BasisPoints: rate.BasisPoints,
+			Tax:         common.NewMoney(taxOf(line.Amount.Amount, rate.BasisPoints), line.Amount.Currency),
+		})
+	}
+	return lines, nil
+}
+
+// bestRate picks the most specific rate that matches the state and category
+func bestRate(rates []models.TaxRate, state, categoryID string) (models.TaxRate, bool) {
+	var best models.TaxRate
+	bestScore := -1
+	for _, rate := range rates {
+		score := 0
+		if rate.State != "" {
+			if !strings.EqualFold(rate.State, state) {
+				continue
+			}
+			score += 2
+		}
+		if rate.CategoryID != "" {
+			if rate.CategoryID != categoryID {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rate, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// taxOf rounds half away from zero to the minor unit
+func taxOf(amount int64, basisPoints int) int64 {
+	tax := amount * int64(basisPoints)
+	if tax < 0 {
+		return -((-tax + 5000) / 10000)
+	}
+	return (tax + 5000) / 10000
+}
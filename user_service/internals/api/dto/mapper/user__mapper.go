@@ -6,6 +6,7 @@ import (
 	"github.com/palashbhasme/ecommerce_microservices/user_service/internals/api/dto/request"
 	"github.com/palashbhasme/ecommerce_microservices/user_service/internals/api/dto/response"
 	"github.com/palashbhasme/ecommerce_microservices/user_service/internals/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // MapUserToResponse maps a User model to a UserResponse struct.
@@ -63,6 +64,7 @@ func mapAddresses(reqAddresses []request.Address) []models.Address {
 
 	for _, address := range reqAddresses {
 		addresses = append(addresses, models.Address{
+			ID:        primitive.NewObjectID().Hex(), // Orders keep the id of the address they were shipped to
 			Line1:     address.Line1,
 			Line2:     address.Line2,
 			City:      address.City,
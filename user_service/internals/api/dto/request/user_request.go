@@ -13,7 +13,7 @@ type UserRequest struct {
 	Email     string    `json:"email" validate:"required,email"`
 	DOB       time.Time `json:"dob" validate:"required"`
 	Phone     string    `json:"phone" validate:"required,len=10"`
-	Addresses []Address `json:"addresses"`
+	Addresses []Address `json:"addresses" validate:"dive"`
 	Account   Account   `json:"account"`
 }
 
@@ -22,7 +22,7 @@ type Address struct {
 	Line2     string `json:"line2,omitempty"`
 	City      string `json:"city" validate:"required"`
 	State     string `json:"state" validate:"required"`
-	Country   string `json:"country" validate:"required"`
+	Country   string `json:"country" validate:"required,iso3166_1_alpha2"` // Upper case, e.g. US
 	ZipCode   string `json:"zip_code" validate:"required"`
 	IsDefault bool   `json:"is_default"`
 }
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -107,7 +109,8 @@ func (h *UserHandler) LoginUser(c *gin.Context) {
 
 	expirationTime := time.Now().Add(60 * time.Minute)
 	claims := models.Claims{
-		Role: user.Account.Role,
+		Role:   user.Account.Role,
+		UserID: string(user.ID),
 		StandardClaims: jwt.StandardClaims{
 			Subject:   user.Email,
 			ExpiresAt: expirationTime.Unix(),
@@ -139,6 +142,11 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	// Country codes are checked and stored upper case, orders look up tax rates by them
+	for i := range userRequest.Addresses {
+		userRequest.Addresses[i].Country = strings.ToUpper(strings.TrimSpace(userRequest.Addresses[i].Country))
+	}
+
 	// Validate struct fields
 	if err := validate.Struct(userRequest); err != nil {
 		h.log.Error("Validation failed", zap.Error(err))
@@ -201,6 +209,12 @@ func (h *UserHandler) GetUserById(c *gin.Context) {
 
 	objectID := models.MyObjectID(id)
 	user, err := h.Repo.GetUserById(objectID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "User not found",
+		})
+		return
+	}
 	if err != nil {
 		h.log.Error("Failed to fetch user", zap.String("id", id), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
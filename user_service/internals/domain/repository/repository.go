@@ -1,9 +1,14 @@
 package repository
 
 import (
+	"errors"
+
 	"github.com/palashbhasme/ecommerce_microservices/user_service/internals/domain/models"
 )
 
+// ErrUserNotFound is returned when no user has the given id
+var ErrUserNotFound = errors.New("user for given id not found")
+
 type UserRepository interface {
 	CreateUser(user *models.User) error
 	UpdateUser(id models.MyObjectID, user *models.User) error
@@ -85,8 +85,11 @@ func (r *MongoUserRepository) GetUserById(id models.MyObjectID) (*models.User, e
 	var user models.User
 	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
 
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
-		return nil, errors.New("user for given id not found")
+		return nil, fmt.Errorf("database error: %w", err)
 	}
 
 	return &user, nil